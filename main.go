@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"./p3"
@@ -21,14 +22,42 @@ func say(s string) {
 	}
 }
 
+// usage:
+//   main [port] [data dir]       run a node, on 6680 by default. Its chain is kept in the
+//                                data dir, data/<port> by default, "" keeps it in memory
+//   main backup <addr> <file>    save the chain of the node at addr to file
+//   main restore <addr> <file>   send the blocks saved in file to the node at addr
 func main() {
+	if len(os.Args) == 4 && os.Args[1] == "backup" {
+		if err := p3.Backup(os.Args[2], os.Args[3]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("chain saved to " + os.Args[3])
+		return
+	}
+	if len(os.Args) == 4 && os.Args[1] == "restore" {
+		added, err := p3.Restore(os.Args[2], os.Args[3])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(added + " blocks restored")
+		return
+	}
 
-	router := p3.NewRouter()
+	port := "6680"
 	if len(os.Args) > 1 {
-		log.Fatal(http.ListenAndServe(":"+os.Args[1], router))
-	} else {
-		log.Fatal(http.ListenAndServe(":6680", router))
+		port = os.Args[1]
+	}
+	dir := filepath.Join("data", port)
+	if len(os.Args) > 2 {
+		dir = os.Args[2]
 	}
+	if err := p3.UseDataDir(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	router := p3.NewRouter()
+	log.Fatal(http.ListenAndServe(":"+port, router))
 }
 
 func Copy(a map[string]int32) map[string]int32 {
@@ -1,14 +1,11 @@
 package p1
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
-
-	"golang.org/x/crypto/sha3"
 )
 
 type Flag_value struct {
@@ -22,10 +19,12 @@ type Node struct {
 	flag_value   Flag_value
 }
 
+// A trie is only a store and a root hash. Stored nodes are never changed, so a copy of
+// the struct is an immutable snapshot: later inserts and deletes on the original move its
+// root without touching the copy.
 type MerklePatriciaTrie struct {
-	db    map[string]Node
-	plain map[string]string
-	root  string
+	db   NodeStore
+	root string
 }
 
 func test_compact_encode() {
@@ -36,22 +35,7 @@ func test_compact_encode() {
 }
 
 func (node *Node) hash_node() string {
-	var str string
-	switch node.node_type {
-	case 0:
-		str = ""
-	case 1:
-		str = "branch_"
-		for _, v := range node.branch_value {
-			str += v
-		}
-	case 2:
-		str = node.flag_value.value
-	}
-	address := string(node.flag_value.encoded_prefix) + node.flag_value.value
-	str = address + str
-	sum := sha3.Sum256([]byte(str))
-	return "HashStart_" + hex.EncodeToString(sum[:]) + "_HashEnd"
+	return HashOf(node.Encode())
 }
 
 func (node *Node) String() string {
@@ -82,8 +66,18 @@ func node_to_string(node Node) string {
 }
 
 func (mpt *MerklePatriciaTrie) Initial() {
-	mpt.db = make(map[string]Node)
-	mpt.plain = make(map[string]string)
+	mpt.InitialWithStore(NewMemoryStore())
+}
+
+// InitialWithStore creates an empty trie whose nodes live in store
+func (mpt *MerklePatriciaTrie) InitialWithStore(store NodeStore) {
+	mpt.db = store
+	mpt.root = ""
+}
+
+// Store returns the node store behind the trie
+func (mpt *MerklePatriciaTrie) Store() NodeStore {
+	return mpt.db
 }
 
 func is_ext_node(encoded_arr []uint8) bool {
@@ -94,72 +88,65 @@ func TestCompact() {
 	test_compact_encode()
 }
 
+// String lists the nodes reachable from the root, the store may hold other tries too
 func (mpt *MerklePatriciaTrie) String() string {
 	content := fmt.Sprintf("ROOT=%s\n", mpt.root)
-	for hash := range mpt.db {
-		content += fmt.Sprintf("%s: %s\n", hash, node_to_string(mpt.db[hash]))
+	queue := []string{}
+	if mpt.root != "" {
+		queue = append(queue, mpt.root)
+	}
+	seen := map[string]bool{}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		node := mpt.getNode(hash)
+		content += fmt.Sprintf("%s: %s\n", hash, node_to_string(node))
+		queue = append(queue, children(node)...)
 	}
 	return content
 }
 
 func (mpt *MerklePatriciaTrie) Get_root() string {
-	fmt.Println("What????????????????????????????????????????", mpt.root)
 	return mpt.root
 }
 
-func (mpt *MerklePatriciaTrie) Order_nodes() string {
-	if len(mpt.db) == 0 {
-		return "empty"
-	}
-	raw_content := mpt.String()
-	content := strings.Split(raw_content, "\n")
-	root_hash := strings.Split(strings.Split(content[0], "HashStart")[1], "HashEnd")[0]
-	queue := []string{root_hash}
-	i := -1
-	rs := ""
-	cur_hash := ""
-	for len(queue) != 0 {
-		last_index := len(queue) - 1
-		cur_hash, queue = queue[last_index], queue[:last_index]
-		i += 1
-		line := ""
-		for _, each := range content {
-			if strings.HasPrefix(each, "HashStart"+cur_hash+"HashEnd") {
-				line = strings.Split(each, "HashEnd: ")[1]
-				rs += each + "\n"
-				rs = strings.Replace(rs, "HashStart"+cur_hash+"HashEnd", fmt.Sprintf("Hash%v", i), -1)
-			}
-		}
-		temp2 := strings.Split(line, "HashStart")
-		flag := true
-		for _, each := range temp2 {
-			if flag {
-				flag = false
-				continue
-			}
-			queue = append(queue, strings.Split(each, "HashEnd")[0])
-		}
-	}
-	return rs
-}
-
 //=================================== helper functions ===================================
 // change string to hex array for encode and create path
+// the key is read byte by byte, so a UTF-8 or binary key keeps every bit of every byte
 func string2hexarray(key string) []uint8 {
-	ascii := []uint8{}
-	for _, r := range key {
-		ascii = append(ascii, uint8(r))
-	}
-	ret := []uint8{}
-	for _, r := range ascii {
-		p := r / 16
-		q := r % 16
+	ret := make([]uint8, 0, 2*len(key))
+	for i := 0; i < len(key); i++ {
+		p := key[i] / 16
+		q := key[i] % 16
 		ret = append(ret, p)
 		ret = append(ret, q)
 	}
 	return ret
 }
 
+// change a hex array back to the key it was created from
+func hexarray2string(path []uint8) (string, bool) {
+	if len(path)%2 != 0 {
+		return "", false
+	}
+	ret := make([]byte, 0, len(path)/2)
+	for i := 0; i < len(path); i += 2 {
+		ret = append(ret, path[i]*16+path[i+1])
+	}
+	return string(ret), true
+}
+
+// concatenate two paths into a new array
+func join_path(a, b []uint8) []uint8 {
+	ret := make([]uint8, 0, len(a)+len(b))
+	ret = append(ret, a...)
+	return append(ret, b...)
+}
+
 // judge if is a leaf node
 func is_leaf(prefix []uint8) bool {
 	if prefix == nil {
@@ -196,8 +183,7 @@ func path_compare(path []uint8, prefix []uint8) ([]uint8, []uint8, []uint8) {
 }
 
 // calculate the size of branch
-func (mpt *MerklePatriciaTrie) branchSize(key string) int {
-	node := mpt.db[key]
+func branchSize(node Node) int {
 	size := 0
 	for i := 0; i < 17; i++ {
 		if node.branch_value[i] != "" {
@@ -207,14 +193,23 @@ func (mpt *MerklePatriciaTrie) branchSize(key string) int {
 	return size
 }
 
-// helper function to print all data in mpt.db
+// helper function to print the nodes of this trie, dead nodes left in mpt.db are skipped
 func (mpt *MerklePatriciaTrie) PrintDB() {
 	if mpt.root == "" {
 		fmt.Println("DB is empty")
 		return
 	}
-	fmt.Println("size of db: ", len(mpt.db))
-	for k, v := range mpt.db {
+	queue := []string{mpt.root}
+	seen := map[string]bool{}
+	for len(queue) != 0 {
+		k := queue[0]
+		queue = queue[1:]
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		v := mpt.getNode(k)
+		queue = append(queue, children(v)...)
 		fmt.Println("Key is : " + k)
 		node_type := v.node_type
 		if node_type == 0 {
@@ -235,53 +230,39 @@ func (mpt *MerklePatriciaTrie) PrintDB() {
 		}
 		fmt.Println("========================================================")
 	}
+	fmt.Println("size of trie: ", len(seen), ", size of db: ", mpt.db.Len())
+}
+
+// get a node from the store, a missing node is a Null node
+func (mpt *MerklePatriciaTrie) getNode(hash string) Node {
+	node, _ := mpt.db.Get(hash)
+	return node
+}
+
+// save a node into the store under its own hash
+func (mpt *MerklePatriciaTrie) putNode(node Node) string {
+	hash := node.hash_node()
+	if err := mpt.db.Put(hash, node); err != nil {
+		fmt.Println("cannot save node " + hash + ": " + err.Error())
+	}
+	return hash
 }
 
 // create a new branchnode
 func (mpt *MerklePatriciaTrie) newBranchNode(branch_value [17]string) string {
 	node := Node{node_type: 1, branch_value: branch_value}
-	hash := node.hash_node()
-	mpt.db[hash] = node
-	return hash
+	return mpt.putNode(node)
 }
 
 // create a new leaf node
 func (mpt *MerklePatriciaTrie) newLeafExtNode(path []uint8, new_value string, leaf bool) string {
 	if leaf {
-		path = append(path, 16)
+		path = join_path(path, []uint8{16})
 	}
 	encoded := compact_encode(path)
 	flag := Flag_value{encoded_prefix: encoded, value: new_value}
 	node := Node{node_type: 2, flag_value: flag}
-	hash := node.hash_node()
-	mpt.db[hash] = node
-	return hash
-}
-
-// update hash in db
-func (mpt *MerklePatriciaTrie) UpdateHash(new_hash string, cur_hash string, prev_hash string) {
-	if new_hash == cur_hash {
-		return
-	}
-	if prev_hash == "" && mpt.root == cur_hash {
-		mpt.root = new_hash
-
-	} else {
-		prev_node := mpt.db[prev_hash]
-		switch prev_node.node_type {
-		case 1: // Branch
-			for i := 0; i < 16; i++ {
-				if prev_node.branch_value[i] == cur_hash {
-					prev_node.branch_value[i] = new_hash
-					break
-				}
-			}
-		case 2: // Ext
-			prev_node.flag_value.value = new_hash
-		}
-		mpt.db[prev_hash] = prev_node
-	}
-	delete(mpt.db, cur_hash)
+	return mpt.putNode(node)
 }
 
 //==============================GET INSERT DELETE==========================================
@@ -301,10 +282,15 @@ func (mpt *MerklePatriciaTrie) Get(key string) (string, error) {
 	return "", errors.New("path_not_found")
 }
 
+// GetBytes is Get for a key that is an arbitrary byte slice
+func (mpt *MerklePatriciaTrie) GetBytes(key []byte) (string, error) {
+	return mpt.Get(string(key))
+}
+
 // helper function for get
 func (mpt *MerklePatriciaTrie) GetHelper(key string, path []uint8) string {
 	// 0: Null, 1: Branch, 2: Ext or Leaf
-	cur_node := mpt.db[key]
+	cur_node := mpt.getNode(key)
 	switch cur_node.node_type {
 	case 1: // Branch
 		if len(path) == 0 {
@@ -320,7 +306,7 @@ func (mpt *MerklePatriciaTrie) GetHelper(key string, path []uint8) string {
 		prefix := cur_node.flag_value.encoded_prefix
 		decoded_prefix := compact_decode(prefix)
 		if is_leaf(prefix) { //Leaf
-			if eq_len(decoded_prefix, path) != len(path) {
+			if !equal_path(decoded_prefix, path) {
 				return ""
 			} else {
 				return cur_node.flag_value.value
@@ -340,230 +326,162 @@ func (mpt *MerklePatriciaTrie) GetHelper(key string, path []uint8) string {
 	}
 }
 func (mpt *MerklePatriciaTrie) GetJsonString() string {
-	b, err := json.Marshal(mpt.plain)
+	plain := map[string]string{}
+	it := mpt.NewIterator()
+	for it.Next() {
+		plain[it.Key()] = it.Value()
+	}
+	if it.Err() != nil {
+		return "{}"
+	}
+	b, err := json.Marshal(plain)
 	if err != nil {
 		return "{}"
 	}
 	return string(b)
 }
 
-// insert new key and value into mpt
-func (mpt *MerklePatriciaTrie) Insert(key string, new_value string) {
+// insert new key and value into mpt, returns the new root
+// nodes in the store are never changed, the path to the key is copied and the root moves
+func (mpt *MerklePatriciaTrie) Insert(key string, new_value string) string {
 	path := string2hexarray(key)
-	if len(mpt.db) == 0 || mpt.root == "" {
-		encoded := compact_encode(append(path, 16))
-		flag := Flag_value{encoded_prefix: encoded, value: new_value}
-		node := Node{node_type: 2, flag_value: flag}
-		hashed := node.hash_node()
-		mpt.db[hashed] = node
-		mpt.root = hashed
-	} else {
-		mpt.InsertHelper(path, new_value, mpt.root, "")
-	}
-	mpt.plain[key] = new_value
-}
-
-// helper function for insert, pass the previous hash, current hash, path and value
-func (mpt *MerklePatriciaTrie) InsertHelper(path []uint8, new_value string, cur_hash string, prev_hash string) string {
-	node := mpt.db[cur_hash]
+	mpt.root = mpt.InsertHelper(path, new_value, mpt.root)
+	return mpt.root
+}
+
+// InsertBytes is Insert for a key that is an arbitrary byte slice
+func (mpt *MerklePatriciaTrie) InsertBytes(key []byte, new_value string) string {
+	return mpt.Insert(string(key), new_value)
+}
+
+// helper function for insert, returns the hash of the new version of cur_hash
+func (mpt *MerklePatriciaTrie) InsertHelper(path []uint8, new_value string, cur_hash string) string {
+	if cur_hash == "" {
+		return mpt.newLeafExtNode(path, new_value, true)
+	}
+	node := mpt.getNode(cur_hash)
 	switch node.node_type {
 	case 1: // Branch
 		if len(path) == 0 {
 			node.branch_value[16] = new_value
-		} else if node.branch_value[path[0]] == "" {
-			node.branch_value[path[0]] = mpt.newLeafExtNode(path[1:], new_value, true)
 		} else {
-			node.branch_value[path[0]] = mpt.InsertHelper(path[1:], new_value, node.branch_value[path[0]], cur_hash)
+			node.branch_value[path[0]] = mpt.InsertHelper(path[1:], new_value, node.branch_value[path[0]])
 		}
+		return mpt.putNode(node)
 	case 2: // Ext or Leaf
 		decoded := compact_decode(node.flag_value.encoded_prefix)
 		eq_part, re_prefix, re_path := path_compare(path, decoded)
 		leaf := is_leaf(node.flag_value.encoded_prefix)
-		if len(re_prefix) == 0 && len(re_path) == 0 { // path == prefix are the same
-			if leaf { //是leaf 就直接更新
-				node.flag_value.value = new_value
-			} else { //是ext, update the next level branch
-				mpt.InsertHelper(re_path, new_value, node.flag_value.value, cur_hash)
-				node = mpt.db[cur_hash]
-			}
-		} else if len(eq_part) == 0 {
-			branch_value := [17]string{}
-			// extension node with 1 element
-			if len(re_path) != 0 {
-				new_node_hash := mpt.newLeafExtNode(re_path[1:], new_value, true)
-				branch_value[re_path[0]] = new_node_hash
-			} else {
-				branch_value[16] = new_value
-			}
-
-			if len(re_prefix) > 1 || leaf {
-				if len(re_prefix) == 0 && leaf {
-					branch_value[16] = node.flag_value.value
-				} else {
-					left_node_hash := mpt.newLeafExtNode(re_prefix[1:], node.flag_value.value, leaf)
-					branch_value[re_prefix[0]] = left_node_hash
-				}
-			} else {
-				branch_value[re_prefix[0]] = node.flag_value.value
-			}
-
-			node.node_type = 1
-			node.branch_value = branch_value
-		} else if len(re_prefix) == 0 && !leaf { // 把remaing的path 弄一个新的 branch插到ext下面的branch node 里面
-			node.flag_value.value = mpt.InsertHelper(re_path, new_value, node.flag_value.value, cur_hash)
-		} else { // re_prefix 依然存在 aab, aac => (aa, b, c)
-			branch_value := [17]string{}
-			if len(re_path) != 0 {
-				new_node_hash := mpt.newLeafExtNode(re_path[1:], new_value, true)
-				branch_value[re_path[0]] = new_node_hash
-			} else {
-				branch_value[16] = new_value
-			}
-			if len(re_prefix) != 0 {
-				if !leaf && len(re_prefix) == 1 {
-					branch_value[re_prefix[0]] = node.flag_value.value
-				} else {
-					left_node_hash := mpt.newLeafExtNode(re_prefix[1:], node.flag_value.value, leaf)
-					branch_value[re_prefix[0]] = left_node_hash
-				}
-			} else { // is leaf
-				branch_value[16] = node.flag_value.value
-			}
-			node.flag_value.encoded_prefix = compact_encode(eq_part) // change original leaf node to ext
-			new_branch_hash := mpt.newBranchNode(branch_value)
-			node.flag_value.value = new_branch_hash
+		if leaf && len(re_prefix) == 0 && len(re_path) == 0 { // same key, update the value
+			return mpt.newLeafExtNode(decoded, new_value, true)
+		}
+		if !leaf && len(re_prefix) == 0 { // the whole ext matches, go down to its branch
+			next_hash := mpt.InsertHelper(re_path, new_value, node.flag_value.value)
+			return mpt.newLeafExtNode(decoded, next_hash, false)
+		}
+		// split the node at the first different nibble: aab, aac => (aa, b, c)
+		branch_value := [17]string{}
+		if len(re_prefix) == 0 {
+			branch_value[16] = node.flag_value.value
+		} else if !leaf && len(re_prefix) == 1 {
+			branch_value[re_prefix[0]] = node.flag_value.value
+		} else {
+			branch_value[re_prefix[0]] = mpt.newLeafExtNode(re_prefix[1:], node.flag_value.value, leaf)
+		}
+		if len(re_path) == 0 {
+			branch_value[16] = new_value
+		} else {
+			branch_value[re_path[0]] = mpt.newLeafExtNode(re_path[1:], new_value, true)
 		}
+		branch_hash := mpt.newBranchNode(branch_value)
+		if len(eq_part) == 0 {
+			return branch_hash
+		}
+		return mpt.newLeafExtNode(eq_part, branch_hash, false)
 	}
-	mpt.db[cur_hash] = node
-	new_hash := node.hash_node()
-	mpt.db[new_hash] = node
-	mpt.UpdateHash(new_hash, cur_hash, prev_hash)
-	return new_hash
+	return mpt.newLeafExtNode(path, new_value, true)
 }
 
-// delete a node from tree
+// delete a node from tree, returns the new root
 func (mpt *MerklePatriciaTrie) Delete(key string) (string, error) {
 	path := string2hexarray(key)
-	_, error := mpt.Get(key)
-	if error != nil {
+	new_root, found := mpt.DeleteHelper(path, mpt.root)
+	if !found {
 		return "", errors.New("path_not_found")
 	}
-	if len(mpt.db) == 1 {
-		delete(mpt.db, mpt.root)
-		mpt.root = ""
-		return "", nil
-	}
-	mpt.DeleteHelper(path, mpt.root, "")
-	delete(mpt.plain, key)
-	return "", nil
+	mpt.root = new_root
+	return mpt.root, nil
+}
+
+// DeleteBytes is Delete for a key that is an arbitrary byte slice
+func (mpt *MerklePatriciaTrie) DeleteBytes(key []byte) (string, error) {
+	return mpt.Delete(string(key))
 }
 
-// delete helper function
-func (mpt *MerklePatriciaTrie) DeleteHelper(path []uint8, cur_hash string, prev_hash string) {
-	node := mpt.db[cur_hash]
-	deleted := false
-	leaf := is_leaf(node.flag_value.encoded_prefix)
+// delete helper function, returns the hash of the new version of cur_hash ("" when
+// nothing is left below it) and whether path was found
+func (mpt *MerklePatriciaTrie) DeleteHelper(path []uint8, cur_hash string) (string, bool) {
+	if cur_hash == "" {
+		return "", false
+	}
+	node := mpt.getNode(cur_hash)
 	switch node.node_type {
-	case 1: //branch && deal with all leaf node inside it
+	case 1: // Branch
 		if len(path) == 0 {
+			if node.branch_value[16] == "" {
+				return cur_hash, false
+			}
 			node.branch_value[16] = ""
-			mpt.db[cur_hash] = node
 		} else {
-			mpt.DeleteHelper(path[1:], node.branch_value[path[0]], cur_hash)
-			node = mpt.db[cur_hash]
+			next_hash, found := mpt.DeleteHelper(path[1:], node.branch_value[path[0]])
+			if !found {
+				return cur_hash, false
+			}
+			node.branch_value[path[0]] = next_hash
+		}
+		if branchSize(node) > 1 {
+			return mpt.putNode(node), true
 		}
-		branch_size := mpt.branchSize(cur_hash)
-		if branch_size < 2 {
-			prev_node := mpt.db[prev_hash]
-			next_hash := ""
-
-			if prev_node.node_type == 2 { //prev_node is ext, cur node deleted
-				if node.branch_value[16] != "" {
-					prev_node.flag_value.value = node.branch_value[16]
-					decoded_prev_prefix := compact_decode(prev_node.flag_value.encoded_prefix)
-					prev_node.flag_value.encoded_prefix = compact_encode(append(decoded_prev_prefix, 16))
-				} else {
-					i := 0
-					for ; i < 16; i++ {
-						if node.branch_value[i] != "" {
-							next_hash = node.branch_value[i]
-							break
-						}
-					}
-					next_node := mpt.db[next_hash]
-					decoded_prev_prefix := compact_decode(prev_node.flag_value.encoded_prefix)
-					decoded_new_prev_prefix := append(decoded_prev_prefix, uint8(i))
-					if next_node.node_type != 1 {
-						decoded_next_prefix := compact_decode(next_node.flag_value.encoded_prefix)
-						decoded_new_prev_prefix = append(decoded_new_prev_prefix, decoded_next_prefix...)
-						if is_leaf(next_node.flag_value.encoded_prefix) {
-							decoded_new_prev_prefix = append(decoded_new_prev_prefix, 16)
-						}
-						delete(mpt.db, next_hash)
-						prev_node.flag_value.value = next_node.flag_value.value
-					} else {
-						prev_node.flag_value.value = next_hash
-					}
-					prev_node.flag_value.encoded_prefix = compact_encode(decoded_new_prev_prefix)
-				}
-				mpt.db[prev_hash] = prev_node
-				delete(mpt.db, cur_hash)
-				deleted = true
-			} else { //prev_node is branch, cur node change to leaf node or ext
-				node.node_type = 2
-				flag_value := Flag_value{}
-				node.flag_value = flag_value
-
-				if node.branch_value[16] != "" { // branch to leaf node without path, 边上一个ext 已经删了
-					node.flag_value.value = node.branch_value[16]
-					node.flag_value.encoded_prefix = compact_encode([]uint8{16})
-				} else { //
-					i := 0
-					for ; i < 16; i++ {
-						if node.branch_value[i] != "" {
-							next_hash = node.branch_value[i]
-							break
-						}
-					}
-					next_node := mpt.db[next_hash]
-					new_prefix := []uint8{uint8(i)}
-					if next_node.node_type == 1 { // br -> br -> br = br -> ex -> br
-						node.flag_value.value = next_hash
-					} else { // br -> br -> ex/leaf
-						decoded_next_prefix := compact_decode(next_node.flag_value.encoded_prefix) // 你坏啦。。。。。。
-						new_prefix = append(new_prefix, decoded_next_prefix...)
-						if is_leaf(next_node.flag_value.encoded_prefix) {
-							new_prefix = append(new_prefix, uint8(16))
-						}
-						node.flag_value.value = next_node.flag_value.value
-						delete(mpt.db, next_hash)
-					}
-					node.flag_value.encoded_prefix = compact_encode(new_prefix)
-				}
+		// only one entry left, the branch turns into a leaf or joins its child
+		if node.branch_value[16] != "" {
+			return mpt.newLeafExtNode([]uint8{}, node.branch_value[16], true), true
+		}
+		for i := 0; i < 16; i++ {
+			if node.branch_value[i] != "" {
+				return mpt.joinPath([]uint8{uint8(i)}, node.branch_value[i]), true
 			}
 		}
-	case 2: // ext or leaf
-		prefix := compact_decode(node.flag_value.encoded_prefix)
-		if leaf && len(path) == eq_len(path, prefix) {
-			prev_node := mpt.db[prev_hash]
-			for i := 0; i < 16; i++ {
-				if prev_node.branch_value[i] == cur_hash {
-					prev_node.branch_value[i] = ""
-					mpt.db[prev_hash] = prev_node
-					deleted = true
-					break
-				}
+		return "", true
+	case 2: // Ext or Leaf
+		decoded := compact_decode(node.flag_value.encoded_prefix)
+		if is_leaf(node.flag_value.encoded_prefix) {
+			if !equal_path(decoded, path) {
+				return cur_hash, false
 			}
-		} else {
-			mpt.DeleteHelper(path[len(prefix):], node.flag_value.value, cur_hash)
-			node = mpt.db[cur_hash]
+			return "", true
+		}
+		if len(decoded) > len(path) || eq_len(decoded, path) != len(decoded) {
+			return cur_hash, false
+		}
+		next_hash, found := mpt.DeleteHelper(path[len(decoded):], node.flag_value.value)
+		if !found {
+			return cur_hash, false
 		}
+		return mpt.joinPath(decoded, next_hash), true
 	}
-	new_hash := node.hash_node()
-	if !deleted {
-		mpt.db[new_hash] = node
-		mpt.UpdateHash(new_hash, cur_hash, prev_hash)
+	return cur_hash, false
+}
+
+// put prefix in front of the node next_hash: a leaf or ext absorbs the prefix,
+// a branch gets a new ext on top of it
+func (mpt *MerklePatriciaTrie) joinPath(prefix []uint8, next_hash string) string {
+	next_node := mpt.getNode(next_hash)
+	if next_node.node_type != 2 {
+		return mpt.newLeafExtNode(prefix, next_hash, false)
 	}
+	next_prefix := next_node.flag_value.encoded_prefix
+	path := join_path(prefix, compact_decode(next_prefix))
+	return mpt.newLeafExtNode(path, next_node.flag_value.value, is_leaf(next_prefix))
 }
 
 func compact_decode(encoded_arr []uint8) []uint8 {
@@ -0,0 +1,249 @@
+package p1
+
+import (
+	"errors"
+)
+
+// Batch collects puts and deletes against a trie and applies them in memory. Nothing is
+// hashed or written to the store until Commit, which hashes every changed node once, so
+// loading n keys costs one pass instead of n root-to-leaf rehashes.
+//
+//	batch := mpt.NewBatch()
+//	batch.Put("content", content)
+//	batch.Put("react", react)
+//	root, err := batch.Commit()
+type Batch struct {
+	mpt  *MerklePatriciaTrie
+	root *batchNode
+	err  error
+}
+
+// batchNode is a node being edited. A node with a hash is still the stored one, it is
+// only read from the store when the batch has to go through it.
+type batchNode struct {
+	hash     string
+	loaded   bool
+	branch   bool
+	leaf     bool
+	path     []uint8
+	value    string
+	children [16]*batchNode
+	next     *batchNode
+}
+
+func (mpt *MerklePatriciaTrie) NewBatch() *Batch {
+	batch := &Batch{mpt: mpt}
+	if mpt.root != "" {
+		batch.root = &batchNode{hash: mpt.root}
+	}
+	return batch
+}
+
+func (batch *Batch) Put(key string, value string) {
+	batch.root = batch.put(batch.root, string2hexarray(key), value)
+}
+
+// Delete removes key, deleting a missing key is not an error inside a batch
+func (batch *Batch) Delete(key string) {
+	batch.root, _ = batch.delete(batch.root, string2hexarray(key))
+}
+
+// Commit hashes and stores the changed nodes, moves the trie to the new root and returns it
+func (batch *Batch) Commit() (string, error) {
+	if batch.err != nil {
+		return batch.mpt.root, batch.err
+	}
+	root := batch.commit(batch.root)
+	if batch.err != nil {
+		return batch.mpt.root, batch.err
+	}
+	batch.mpt.root = root
+	batch.root = nil
+	if root != "" {
+		batch.root = &batchNode{hash: root}
+	}
+	return root, nil
+}
+
+// load the stored node behind n, its children stay unloaded
+func (batch *Batch) resolve(n *batchNode) {
+	if n.loaded || n.hash == "" {
+		return
+	}
+	node, ok := batch.mpt.db.Get(n.hash)
+	if !ok {
+		if batch.err == nil {
+			batch.err = errors.New("missing_node")
+		}
+		return
+	}
+	n.loaded = true
+	switch node.node_type {
+	case 1:
+		n.branch = true
+		n.value = node.branch_value[16]
+		for i := 0; i < 16; i++ {
+			if node.branch_value[i] != "" {
+				n.children[i] = &batchNode{hash: node.branch_value[i]}
+			}
+		}
+	case 2:
+		n.path = compact_decode(node.flag_value.encoded_prefix)
+		n.leaf = is_leaf(node.flag_value.encoded_prefix)
+		if n.leaf {
+			n.value = node.flag_value.value
+		} else {
+			n.next = &batchNode{hash: node.flag_value.value}
+		}
+	}
+}
+
+func newBatchLeaf(path []uint8, value string) *batchNode {
+	return &batchNode{loaded: true, leaf: true, path: join_path(path, nil), value: value}
+}
+
+func newBatchExt(path []uint8, next *batchNode) *batchNode {
+	return &batchNode{loaded: true, path: join_path(path, nil), next: next}
+}
+
+// same steps as InsertHelper, on nodes in memory
+func (batch *Batch) put(n *batchNode, path []uint8, value string) *batchNode {
+	if n == nil {
+		return newBatchLeaf(path, value)
+	}
+	batch.resolve(n)
+	n.hash = ""
+	if n.branch {
+		if len(path) == 0 {
+			n.value = value
+		} else {
+			n.children[path[0]] = batch.put(n.children[path[0]], path[1:], value)
+		}
+		return n
+	}
+	common := min_len(n.path, path)
+	for i := 0; i < common; i++ {
+		if n.path[i] != path[i] {
+			common = i
+			break
+		}
+	}
+	if n.leaf && common == len(n.path) && common == len(path) {
+		n.value = value
+		return n
+	}
+	if !n.leaf && common == len(n.path) {
+		n.next = batch.put(n.next, path[common:], value)
+		return n
+	}
+	// split at the first different nibble
+	branch := &batchNode{loaded: true, branch: true}
+	re_prefix := n.path[common:]
+	if len(re_prefix) == 0 {
+		branch.value = n.value
+	} else if n.leaf {
+		branch.children[re_prefix[0]] = newBatchLeaf(re_prefix[1:], n.value)
+	} else if len(re_prefix) == 1 {
+		branch.children[re_prefix[0]] = n.next
+	} else {
+		branch.children[re_prefix[0]] = newBatchExt(re_prefix[1:], n.next)
+	}
+	re_path := path[common:]
+	if len(re_path) == 0 {
+		branch.value = value
+	} else {
+		branch.children[re_path[0]] = newBatchLeaf(re_path[1:], value)
+	}
+	if common == 0 {
+		return branch
+	}
+	return newBatchExt(path[:common], branch)
+}
+
+// same steps as DeleteHelper, on nodes in memory
+func (batch *Batch) delete(n *batchNode, path []uint8) (*batchNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	batch.resolve(n)
+	if !n.branch {
+		if n.leaf {
+			if !equal_path(n.path, path) {
+				return n, false
+			}
+			return nil, true
+		}
+		if len(n.path) > len(path) || !equal_path(n.path, path[:len(n.path)]) {
+			return n, false
+		}
+		next, found := batch.delete(n.next, path[len(n.path):])
+		if !found {
+			return n, false
+		}
+		return batch.join(n.path, next), true
+	}
+	if len(path) == 0 {
+		if n.value == "" {
+			return n, false
+		}
+		n.value = ""
+	} else {
+		next, found := batch.delete(n.children[path[0]], path[1:])
+		if !found {
+			return n, false
+		}
+		n.children[path[0]] = next
+	}
+	n.hash = ""
+	size, last := 0, -1
+	for i := 0; i < 16; i++ {
+		if n.children[i] != nil {
+			size++
+			last = i
+		}
+	}
+	if n.value != "" {
+		size++
+	}
+	if size > 1 {
+		return n, true
+	}
+	if n.value != "" {
+		return newBatchLeaf([]uint8{}, n.value), true
+	}
+	return batch.join([]uint8{uint8(last)}, n.children[last]), true
+}
+
+// put prefix in front of next, like joinPath
+func (batch *Batch) join(prefix []uint8, next *batchNode) *batchNode {
+	batch.resolve(next)
+	if next.branch {
+		return newBatchExt(prefix, next)
+	}
+	next.hash = ""
+	next.path = join_path(prefix, next.path)
+	return next
+}
+
+// hash the changed nodes bottom up and store them
+func (batch *Batch) commit(n *batchNode) string {
+	if n == nil || batch.err != nil {
+		return ""
+	}
+	if n.hash != "" {
+		return n.hash
+	}
+	if n.branch {
+		branch_value := [17]string{}
+		for i := 0; i < 16; i++ {
+			branch_value[i] = batch.commit(n.children[i])
+		}
+		branch_value[16] = n.value
+		n.hash = batch.mpt.newBranchNode(branch_value)
+	} else if n.leaf {
+		n.hash = batch.mpt.newLeafExtNode(n.path, n.value, true)
+	} else {
+		n.hash = batch.mpt.newLeafExtNode(n.path, batch.commit(n.next), false)
+	}
+	return n.hash
+}
@@ -0,0 +1,68 @@
+package p1
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func random_keys(n int) []string {
+	r := rand.New(rand.NewSource(int64(n)))
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key/%d/%d", i, r.Int63())
+	}
+	return keys
+}
+
+func TestBatchSameRootAsInsert(t *testing.T) {
+	keys := random_keys(2000)
+	one := MerklePatriciaTrie{}
+	one.Initial()
+	for _, key := range keys {
+		one.Insert(key, key)
+	}
+	batched := MerklePatriciaTrie{}
+	batched.Initial()
+	batch := batched.NewBatch()
+	for _, key := range keys {
+		batch.Put(key, key)
+	}
+	if root, err := batch.Commit(); err != nil || root != one.root {
+		t.Fatalf("batch root %s, %v, insert root %s", root, err, one.root)
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, n := range []int{10000, 50000} {
+		keys := random_keys(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mpt := MerklePatriciaTrie{}
+				mpt.Initial()
+				for _, key := range keys {
+					mpt.Insert(key, key)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	for _, n := range []int{10000, 50000} {
+		keys := random_keys(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mpt := MerklePatriciaTrie{}
+				mpt.Initial()
+				batch := mpt.NewBatch()
+				for _, key := range keys {
+					batch.Put(key, key)
+				}
+				if _, err := batch.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
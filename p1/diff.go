@@ -0,0 +1,164 @@
+package p1
+
+import "errors"
+
+// KeyChange is a key whose value differs between the two versions
+type KeyChange struct {
+	Key      string
+	OldValue string
+	NewValue string
+}
+
+// TrieDiff lists what changed from one root to another, every list in key order.
+// Nodes holds the hashes of the nodes of the new version that the old one does not
+// share at the same place, which is all a peer holding the old version has to fetch.
+type TrieDiff struct {
+	Added   []KeyValue
+	Removed []KeyValue
+	Changed []KeyChange
+	Nodes   []string
+}
+
+// Diff compares the trie old with the trie new. Subtrees with the same hash on both sides
+// are skipped without being read, so the cost depends on the size of the change only.
+func Diff(old MerklePatriciaTrie, new MerklePatriciaTrie) (TrieDiff, error) {
+	d := differ{old: old.db, new: new.db}
+	d.diff.Added = []KeyValue{}
+	d.diff.Removed = []KeyValue{}
+	d.diff.Changed = []KeyChange{}
+	d.diff.Nodes = []string{}
+	a := d.load(old.db, old.root)
+	b := d.load(new.db, new.root)
+	d.compare(a, b, []uint8{})
+	return d.diff, d.err
+}
+
+type differ struct {
+	old  NodeStore
+	new  NodeStore
+	diff TrieDiff
+	err  error
+}
+
+// diffRef is a subtree seen from one nibble path. Extensions and leaves are cut one
+// nibble at a time into virtual nodes, which are not in any store, so both sides can
+// always be compared slot by slot like two branches.
+type diffRef struct {
+	hash    string
+	node    Node
+	virtual bool
+}
+
+func (d *differ) load(store NodeStore, hash string) diffRef {
+	if hash == "" {
+		return diffRef{}
+	}
+	node, ok := store.Get(hash)
+	if !ok && d.err == nil {
+		d.err = errors.New("missing_node")
+	}
+	return diffRef{hash: hash, node: node}
+}
+
+func virtualRef(path []uint8, value string, leaf bool) diffRef {
+	if leaf {
+		path = join_path(path, []uint8{16})
+	}
+	node := Node{node_type: 2, flag_value: Flag_value{encoded_prefix: compact_encode(path), value: value}}
+	return diffRef{hash: node.hash_node(), node: node, virtual: true}
+}
+
+// expand returns the value stored right at the subtree's path and its 16 children
+func (d *differ) expand(store NodeStore, ref diffRef) (string, [16]diffRef) {
+	kids := [16]diffRef{}
+	node := ref.node
+	switch node.node_type {
+	case 1: // Branch
+		for i := 0; i < 16; i++ {
+			kids[i] = d.load(store, node.branch_value[i])
+		}
+		return node.branch_value[16], kids
+	case 2: // Ext or Leaf
+		prefix := compact_decode(node.flag_value.encoded_prefix)
+		if is_leaf(node.flag_value.encoded_prefix) {
+			if len(prefix) == 0 {
+				return node.flag_value.value, kids
+			}
+			kids[prefix[0]] = virtualRef(prefix[1:], node.flag_value.value, true)
+		} else if len(prefix) == 1 {
+			kids[prefix[0]] = d.load(store, node.flag_value.value)
+		} else {
+			kids[prefix[0]] = virtualRef(prefix[1:], node.flag_value.value, false)
+		}
+	}
+	return "", kids
+}
+
+func (d *differ) compare(a diffRef, b diffRef, path []uint8) {
+	if d.err != nil {
+		return
+	}
+	if a.hash == b.hash {
+		// same content, but the old side only had it as a piece of a longer node
+		if a.virtual && !b.virtual {
+			d.diff.Nodes = append(d.diff.Nodes, b.hash)
+		}
+		return
+	}
+	if a.hash == "" {
+		d.collect(d.new, b, path, false)
+		return
+	}
+	if b.hash == "" {
+		d.collect(d.old, a, path, true)
+		return
+	}
+	if !b.virtual {
+		d.diff.Nodes = append(d.diff.Nodes, b.hash)
+	}
+	old_value, old_kids := d.expand(d.old, a)
+	new_value, new_kids := d.expand(d.new, b)
+	if old_value != new_value {
+		key := d.key(path)
+		if old_value == "" {
+			d.diff.Added = append(d.diff.Added, KeyValue{Key: key, Value: new_value})
+		} else if new_value == "" {
+			d.diff.Removed = append(d.diff.Removed, KeyValue{Key: key, Value: old_value})
+		} else {
+			d.diff.Changed = append(d.diff.Changed, KeyChange{Key: key, OldValue: old_value, NewValue: new_value})
+		}
+	}
+	for i := 0; i < 16; i++ {
+		d.compare(old_kids[i], new_kids[i], join_path(path, []uint8{uint8(i)}))
+	}
+}
+
+// collect reports every entry below ref as removed (old side) or added (new side)
+func (d *differ) collect(store NodeStore, ref diffRef, path []uint8, removed bool) {
+	if d.err != nil || ref.hash == "" {
+		return
+	}
+	if !removed && !ref.virtual {
+		d.diff.Nodes = append(d.diff.Nodes, ref.hash)
+	}
+	value, kids := d.expand(store, ref)
+	if value != "" {
+		entry := KeyValue{Key: d.key(path), Value: value}
+		if removed {
+			d.diff.Removed = append(d.diff.Removed, entry)
+		} else {
+			d.diff.Added = append(d.diff.Added, entry)
+		}
+	}
+	for i := 0; i < 16; i++ {
+		d.collect(store, kids[i], join_path(path, []uint8{uint8(i)}), removed)
+	}
+}
+
+func (d *differ) key(path []uint8) string {
+	key, ok := hexarray2string(path)
+	if !ok && d.err == nil {
+		d.err = errors.New("odd_key_path")
+	}
+	return key
+}
@@ -0,0 +1,109 @@
+package p1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func diff_tries() (MerklePatriciaTrie, MerklePatriciaTrie) {
+	old := MerklePatriciaTrie{}
+	old.Initial()
+	for key, value := range map[string]string{"choice/A": "1", "choice/B": "2", "hint/1": "h", "react": "r", "content": "c"} {
+		old.Insert(key, value)
+	}
+	new := old.Snapshot()
+	new.Insert("choice/C", "3")
+	new.Insert("hint/10", "hh")
+	new.Delete("react")
+	new.Delete("choice/A")
+	new.Insert("content", "c2")
+	new.Insert("choice/B", "22")
+	return old, new
+}
+
+func TestDiff(t *testing.T) {
+	old, new := diff_tries()
+	diff, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := []KeyValue{{"choice/C", "3"}, {"hint/10", "hh"}}
+	removed := []KeyValue{{"choice/A", "1"}, {"react", "r"}}
+	changed := []KeyChange{{"choice/B", "2", "22"}, {"content", "c", "c2"}}
+	if !reflect.DeepEqual(diff.Added, added) {
+		t.Errorf("added %v, want %v", diff.Added, added)
+	}
+	if !reflect.DeepEqual(diff.Removed, removed) {
+		t.Errorf("removed %v, want %v", diff.Removed, removed)
+	}
+	if !reflect.DeepEqual(diff.Changed, changed) {
+		t.Errorf("changed %v, want %v", diff.Changed, changed)
+	}
+
+	same, err := Diff(new, new)
+	if err != nil || len(same.Added)+len(same.Removed)+len(same.Changed)+len(same.Nodes) != 0 {
+		t.Errorf("diff of a trie with itself: %+v, %v", same, err)
+	}
+}
+
+// a store holding the old version and the nodes of the diff holds the new version whole
+func TestDiffNodesRebuildNewRoot(t *testing.T) {
+	old, new := diff_tries()
+	diff, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	if _, err := ImportNodes(store, old.ExportNodes()); err != nil {
+		t.Fatal(err)
+	}
+	copy_nodes(t, new.db, store, diff.Nodes)
+	check_rebuilt(t, store, &new)
+
+	// from nothing, every node of the new version is in the diff
+	empty := MerklePatriciaTrie{}
+	empty.Initial()
+	diff, err = Diff(empty, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 5 || len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Errorf("diff from an empty trie: %+v", diff)
+	}
+	store = NewMemoryStore()
+	copy_nodes(t, new.db, store, diff.Nodes)
+	check_rebuilt(t, store, &new)
+}
+
+func copy_nodes(t *testing.T, from NodeStore, to NodeStore, hashes []string) {
+	for _, hash := range hashes {
+		node, ok := from.Get(hash)
+		if !ok {
+			t.Fatalf("diff lists %s, which is not a node of the new version", hash)
+		}
+		to.Put(hash, node)
+	}
+}
+
+// every node of want is in store and the trie opened there reads the same pairs
+func check_rebuilt(t *testing.T, store NodeStore, want *MerklePatriciaTrie) {
+	t.Helper()
+	queue := []string{want.root}
+	for len(queue) != 0 {
+		node, ok := store.Get(queue[0])
+		if !ok {
+			t.Fatalf("node %s of the new version is missing", queue[0])
+		}
+		queue = append(queue[1:], children(node)...)
+	}
+	rebuilt, err := OpenTrie(store, want.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := want.NewIterator()
+	for it.Next() {
+		if value, err := rebuilt.Get(it.Key()); err != nil || value != it.Value() {
+			t.Errorf("rebuilt get %s = %q, %v, want %q", it.Key(), value, err, it.Value())
+		}
+	}
+}
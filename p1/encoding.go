@@ -0,0 +1,151 @@
+package p1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Canonical node encoding. Every node is one kind byte followed by length prefixed items:
+//   Branch: 0x01, 16 child hashes (empty or 32 raw bytes), value
+//   Ext:    0x02, encoded prefix, child hash (32 raw bytes)
+//   Leaf:   0x03, encoded prefix, value
+// Lengths are uvarints, so no two different nodes share an encoding, and the hash of a
+// node is the SHA3-256 of its encoding.
+const (
+	kind_branch = 0x01
+	kind_ext    = 0x02
+	kind_leaf   = 0x03
+	hash_size   = 32
+)
+
+// Encode returns the canonical encoding of the node, the form that is hashed and sent to peers
+func (node *Node) Encode() []byte {
+	buf := bytes.Buffer{}
+	switch node.node_type {
+	case 1:
+		buf.WriteByte(kind_branch)
+		for _, child := range node.branch_value[:16] {
+			write_item(&buf, hash_bytes(child))
+		}
+		write_item(&buf, []byte(node.branch_value[16]))
+	case 2:
+		if is_leaf(node.flag_value.encoded_prefix) {
+			buf.WriteByte(kind_leaf)
+			write_item(&buf, node.flag_value.encoded_prefix)
+			write_item(&buf, []byte(node.flag_value.value))
+		} else {
+			buf.WriteByte(kind_ext)
+			write_item(&buf, node.flag_value.encoded_prefix)
+			write_item(&buf, hash_bytes(node.flag_value.value))
+		}
+	}
+	return buf.Bytes()
+}
+
+// DecodeNode parses a canonical node encoding. Anything that would not encode back to
+// exactly the same bytes is rejected, so a decoded node always has the hash of its input.
+func DecodeNode(data []byte) (Node, error) {
+	node := Node{}
+	if len(data) == 0 {
+		return node, errors.New("empty_node")
+	}
+	rest := data[1:]
+	var err error
+	switch data[0] {
+	case kind_branch:
+		node.node_type = 1
+		for i := 0; i < 16; i++ {
+			var child []byte
+			if child, rest, err = read_item(rest); err != nil {
+				return Node{}, err
+			}
+			if len(child) != 0 && len(child) != hash_size {
+				return Node{}, errors.New("bad_child_hash")
+			}
+			if len(child) != 0 {
+				node.branch_value[i] = hex.EncodeToString(child)
+			}
+		}
+		var value []byte
+		if value, rest, err = read_item(rest); err != nil {
+			return Node{}, err
+		}
+		node.branch_value[16] = string(value)
+	case kind_ext, kind_leaf:
+		node.node_type = 2
+		var prefix, value []byte
+		if prefix, rest, err = read_item(rest); err != nil {
+			return Node{}, err
+		}
+		if value, rest, err = read_item(rest); err != nil {
+			return Node{}, err
+		}
+		if !valid_prefix(prefix) || is_leaf(prefix) != (data[0] == kind_leaf) {
+			return Node{}, errors.New("bad_prefix")
+		}
+		node.flag_value.encoded_prefix = prefix
+		if data[0] == kind_ext {
+			if len(value) != hash_size {
+				return Node{}, errors.New("bad_child_hash")
+			}
+			node.flag_value.value = hex.EncodeToString(value)
+		} else {
+			node.flag_value.value = string(value)
+		}
+	default:
+		return Node{}, errors.New("unknown_node_kind")
+	}
+	if len(rest) != 0 {
+		return Node{}, errors.New("trailing_bytes")
+	}
+	if !bytes.Equal(node.Encode(), data) {
+		return Node{}, errors.New("non_canonical_node")
+	}
+	return node, nil
+}
+
+// HashOf returns the hash a peer should store the encoded node under
+func HashOf(data []byte) string {
+	sum := sha3.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func write_item(buf *bytes.Buffer, item []byte) {
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(len(item)))
+	buf.Write(size[:n])
+	buf.Write(item)
+}
+
+func read_item(data []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, errors.New("truncated_node")
+	}
+	end := n + int(size)
+	return data[n:end], data[end:], nil
+}
+
+// the first nibble of a compact encoded prefix is the flag 0-3, an even flag is padded with 0
+func valid_prefix(prefix []uint8) bool {
+	if len(prefix) == 0 || prefix[0]/16 > 3 {
+		return false
+	}
+	return prefix[0]/16%2 == 1 || prefix[0]%16 == 0
+}
+
+// a node reference is kept as hex in memory and as raw bytes in the encoding
+func hash_bytes(hash string) []byte {
+	if hash == "" {
+		return nil
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return []byte(hash)
+	}
+	return raw
+}
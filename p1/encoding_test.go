@@ -0,0 +1,61 @@
+package p1
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the nodes of a trie with branches, extensions and leaves, some with empty values
+func sample_nodes(t *testing.T) [][]byte {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("a", "1")
+	mpt.Insert("ab", "")
+	mpt.Insert("abc", "3")
+	mpt.Insert("b", "4")
+	mpt.Insert("xyz", "5")
+	encoded := [][]byte{}
+	kinds := map[byte]bool{}
+	mpt.db.Range(func(hash string, node Node) {
+		data := node.Encode()
+		kinds[data[0]] = true
+		encoded = append(encoded, data)
+	})
+	if !kinds[kind_branch] || !kinds[kind_ext] || !kinds[kind_leaf] {
+		t.Fatalf("sample trie lacks a node kind: %v", kinds)
+	}
+	return encoded
+}
+
+func TestNodeEncodingRoundTrip(t *testing.T) {
+	for _, data := range sample_nodes(t) {
+		node, err := DecodeNode(data)
+		if err != nil {
+			t.Fatalf("decode %x: %v", data, err)
+		}
+		if again := node.Encode(); !bytes.Equal(again, data) {
+			t.Errorf("%x encodes back to %x", data, again)
+		}
+	}
+}
+
+func TestDecodeNodeRejectsNonCanonical(t *testing.T) {
+	for _, data := range sample_nodes(t) {
+		if _, err := DecodeNode(append(append([]byte{}, data...), 0)); err == nil {
+			t.Errorf("%x with a trailing byte decoded", data)
+		}
+		if _, err := DecodeNode(data[:len(data)-1]); err == nil {
+			t.Errorf("%x cut short decoded", data)
+		}
+		// the length of the first item written in two bytes instead of one
+		long := append([]byte{data[0], data[1] | 0x80, 0x00}, data[2:]...)
+		if _, err := DecodeNode(long); err == nil {
+			t.Errorf("%x with a non-minimal length decoded", data)
+		}
+	}
+	for _, data := range [][]byte{nil, {0x04}, {kind_leaf, 1, 0x40, 0}, {kind_ext, 1, 0x00, 1, 0xaa}} {
+		if _, err := DecodeNode(data); err == nil {
+			t.Errorf("%x decoded", data)
+		}
+	}
+}
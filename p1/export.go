@@ -0,0 +1,142 @@
+package p1
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// TrieJson is the node level form of a trie: the root hash and the canonical encoding
+// (hex) of every node reachable from it. Unlike GetJsonString it carries the exact
+// structure, so the receiver can check it got the same trie and not only the same pairs.
+type TrieJson struct {
+	Root  string   `json:"root"`
+	Nodes []string `json:"nodes"`
+}
+
+// ExportNodes lists every node reachable from the root, parents before children
+func (mpt *MerklePatriciaTrie) ExportNodes() TrieJson {
+	export := TrieJson{Root: mpt.root, Nodes: []string{}}
+	if mpt.root == "" {
+		return export
+	}
+	queue := []string{mpt.root}
+	seen := map[string]bool{mpt.root: true}
+	for len(queue) != 0 {
+		node := mpt.getNode(queue[0])
+		queue = queue[1:]
+		export.Nodes = append(export.Nodes, hex.EncodeToString(node.Encode()))
+		for _, child := range children(node) {
+			if !seen[child] {
+				seen[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return export
+}
+
+func (mpt *MerklePatriciaTrie) GetNodesJsonString() string {
+	b, err := json.Marshal(mpt.ExportNodes())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// ImportNodes rebuilds the trie described by export into store. Every node is re-hashed
+// from its encoding, every child reference must be one of the exported nodes, and the
+// recomputed root must be the advertised one. Nothing is written to store when the export
+// is not valid, and the nodes are written children first in case a write fails.
+func ImportNodes(store NodeStore, export TrieJson) (MerklePatriciaTrie, error) {
+	nodes := map[string]Node{}
+	for _, encoded := range export.Nodes {
+		data, err := hex.DecodeString(encoded)
+		if err != nil {
+			return MerklePatriciaTrie{}, errors.New("bad_node_hex")
+		}
+		node, err := DecodeNode(data)
+		if err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+		nodes[HashOf(data)] = node
+	}
+	if export.Root == "" {
+		if len(nodes) != 0 {
+			return MerklePatriciaTrie{}, errors.New("root_mismatch")
+		}
+		return OpenTrie(store, "")
+	}
+	if _, ok := nodes[export.Root]; !ok {
+		return MerklePatriciaTrie{}, errors.New("root_mismatch")
+	}
+	reachable := map[string]bool{}
+	queue := []string{export.Root}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if reachable[hash] {
+			continue
+		}
+		node, ok := nodes[hash]
+		if !ok {
+			return MerklePatriciaTrie{}, errors.New("missing_node")
+		}
+		reachable[hash] = true
+		queue = append(queue, children(node)...)
+	}
+	for _, hash := range children_first(export.Root, nodes) {
+		if err := store.Put(hash, nodes[hash]); err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+	}
+	return OpenTrie(store, export.Root)
+}
+
+func DecodeNodesJson(store NodeStore, jsonString string) (MerklePatriciaTrie, error) {
+	var export TrieJson
+	if err := json.Unmarshal([]byte(jsonString), &export); err != nil {
+		return MerklePatriciaTrie{}, err
+	}
+	return ImportNodes(store, export)
+}
+
+// hashes of the nodes directly below node
+func children(node Node) []string {
+	ret := []string{}
+	switch node.node_type {
+	case 1:
+		for _, child := range node.branch_value[:16] {
+			if child != "" {
+				ret = append(ret, child)
+			}
+		}
+	case 2:
+		if !is_leaf(node.flag_value.encoded_prefix) {
+			ret = append(ret, node.flag_value.value)
+		}
+	}
+	return ret
+}
+
+// children_first lists the nodes below root that are in nodes, each one after all of its
+// children. A store written in this order never holds a node without its subtree, even
+// when a write fails halfway, see SyncTrie.
+func children_first(root string, nodes map[string]Node) []string {
+	order := []string{}
+	done := map[string]bool{}
+	var visit func(hash string)
+	visit = func(hash string) {
+		node, ok := nodes[hash]
+		if !ok || done[hash] {
+			return
+		}
+		done[hash] = true
+		for _, child := range children(node) {
+			visit(child)
+		}
+		order = append(order, hash)
+	}
+	visit(root)
+	return order
+}
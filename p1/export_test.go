@@ -0,0 +1,101 @@
+package p1
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func export_trie() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, key := range []string{"a", "ab", "abc", "b", "choice/A", "choice/B", "hint/1"} {
+		mpt.Insert(key, "v"+key)
+	}
+	return mpt
+}
+
+func TestImportNodesRoundTrip(t *testing.T) {
+	mpt := export_trie()
+	store := NewMemoryStore()
+	imported, err := ImportNodes(store, mpt.ExportNodes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Get_root() != mpt.Get_root() || store.Len() != len(mpt.ExportNodes().Nodes) {
+		t.Fatalf("imported root %s with %d nodes", imported.Get_root(), store.Len())
+	}
+	if value, err := imported.Get("choice/B"); err != nil || value != "vchoice/B" {
+		t.Fatalf("get choice/B = %q, %v", value, err)
+	}
+}
+
+func TestImportNodesRejectsTamperedNode(t *testing.T) {
+	mpt := export_trie()
+	for i := range mpt.ExportNodes().Nodes {
+		export := mpt.ExportNodes()
+		data, _ := hex.DecodeString(export.Nodes[i])
+		data[len(data)-1] ^= 1
+		export.Nodes[i] = hex.EncodeToString(data)
+		store := NewMemoryStore()
+		if _, err := ImportNodes(store, export); err == nil {
+			t.Errorf("imported with node %d tampered", i)
+		}
+		if store.Len() != 0 {
+			t.Errorf("%d nodes written for a rejected import", store.Len())
+		}
+	}
+}
+
+func TestImportNodesRejectsMissingNode(t *testing.T) {
+	mpt := export_trie()
+	for i := range mpt.ExportNodes().Nodes {
+		export := mpt.ExportNodes()
+		export.Nodes = append(export.Nodes[:i], export.Nodes[i+1:]...)
+		store := NewMemoryStore()
+		if _, err := ImportNodes(store, export); err == nil {
+			t.Errorf("imported without node %d", i)
+		}
+		if store.Len() != 0 {
+			t.Errorf("%d nodes written for a rejected import", store.Len())
+		}
+	}
+	export := mpt.ExportNodes()
+	export.Root = HashOf([]byte("another trie"))
+	if _, err := ImportNodes(NewMemoryStore(), export); err == nil {
+		t.Error("imported under another root")
+	}
+}
+
+// failing_store fails every Put after the first n
+type failing_store struct {
+	*MemoryStore
+	n int
+}
+
+func (store *failing_store) Put(hash string, node Node) error {
+	if store.n == 0 {
+		return errors.New("disk full")
+	}
+	store.n--
+	return store.MemoryStore.Put(hash, node)
+}
+
+// whatever an import writes before it fails, every stored node has its subtree
+func TestImportNodesWritesChildrenFirst(t *testing.T) {
+	mpt := export_trie()
+	export := mpt.ExportNodes()
+	for n := 0; n < len(export.Nodes); n++ {
+		store := &failing_store{MemoryStore: NewMemoryStore(), n: n}
+		if _, err := ImportNodes(store, export); err == nil {
+			t.Fatalf("import with %d writes left succeeded", n)
+		}
+		store.Range(func(hash string, node Node) {
+			for _, child := range children(node) {
+				if _, ok := store.Get(child); !ok {
+					t.Fatalf("after %d writes node %s is stored without its child %s", n, hash, child)
+				}
+			}
+		})
+	}
+}
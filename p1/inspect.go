@@ -0,0 +1,197 @@
+package p1
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NodeKind tells what a node is, with the same numbers as the kind byte of the encoding
+type NodeKind int
+
+const (
+	KindBranch    NodeKind = kind_branch
+	KindExtension NodeKind = kind_ext
+	KindLeaf      NodeKind = kind_leaf
+)
+
+func (kind NodeKind) String() string {
+	switch kind {
+	case KindBranch:
+		return "Branch"
+	case KindExtension:
+		return "Ext"
+	case KindLeaf:
+		return "Leaf"
+	}
+	return "Unknown"
+}
+
+// NodeChild is one edge below a node, Nibble is the branch slot or -1 below an extension
+type NodeChild struct {
+	Nibble int
+	Hash   string
+}
+
+// NodeView is a read only look at one node, seen from the place it has in the trie
+type NodeView struct {
+	Hash     string
+	Kind     NodeKind
+	Path     []uint8 // nibbles from the root to this node
+	Prefix   []uint8 // nibbles an extension or leaf holds, empty for a branch
+	Children []NodeChild
+	Value    string // value of a leaf, or of the key ending at a branch
+	Depth    int    // number of nodes above this one
+}
+
+// Key returns the key of a leaf, or of the key ending at a branch
+func (view NodeView) Key() (string, bool) {
+	if view.Kind == KindExtension || view.Value == "" {
+		return "", false
+	}
+	return hexarray2string(join_path(view.Path, view.Prefix))
+}
+
+func newNodeView(hash string, node Node, path []uint8, depth int) NodeView {
+	view := NodeView{Hash: hash, Path: path, Prefix: []uint8{}, Children: []NodeChild{}, Depth: depth}
+	switch node.node_type {
+	case 1:
+		view.Kind = KindBranch
+		for i, child := range node.branch_value[:16] {
+			if child != "" {
+				view.Children = append(view.Children, NodeChild{Nibble: i, Hash: child})
+			}
+		}
+		view.Value = node.branch_value[16]
+	case 2:
+		view.Prefix = compact_decode(node.flag_value.encoded_prefix)
+		if is_leaf(node.flag_value.encoded_prefix) {
+			view.Kind = KindLeaf
+			view.Value = node.flag_value.value
+		} else {
+			view.Kind = KindExtension
+			view.Children = append(view.Children, NodeChild{Nibble: -1, Hash: node.flag_value.value})
+		}
+	}
+	return view
+}
+
+// Walk calls fn for every node depth first, a parent before its children and children in
+// nibble order. A subtree that appears at two places is visited at both. When fn returns
+// false the children of that node are skipped.
+func (mpt *MerklePatriciaTrie) Walk(fn func(view NodeView) bool) error {
+	if mpt.root == "" {
+		return nil
+	}
+	return mpt.walk(mpt.root, []uint8{}, 0, fn)
+}
+
+func (mpt *MerklePatriciaTrie) walk(hash string, path []uint8, depth int, fn func(view NodeView) bool) error {
+	node, ok := mpt.db.Get(hash)
+	if !ok {
+		return errors.New("missing_node")
+	}
+	view := newNodeView(hash, node, path, depth)
+	if !fn(view) {
+		return nil
+	}
+	for _, child := range view.Children {
+		child_path := join_path(path, view.Prefix)
+		if child.Nibble >= 0 {
+			child_path = join_path(child_path, []uint8{uint8(child.Nibble)})
+		}
+		if err := mpt.walk(child.Hash, child_path, depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Nodes returns the views of every node in Walk order
+func (mpt *MerklePatriciaTrie) Nodes() ([]NodeView, error) {
+	views := []NodeView{}
+	err := mpt.Walk(func(view NodeView) bool {
+		views = append(views, view)
+		return true
+	})
+	return views, err
+}
+
+// Order_nodes lists the nodes depth first from the root, naming them Hash0, Hash1, ...
+func (mpt *MerklePatriciaTrie) Order_nodes() string {
+	if mpt.root == "" {
+		return "empty"
+	}
+	names := map[string]string{}
+	order := []string{}
+	mpt.Walk(func(view NodeView) bool {
+		if _, ok := names[view.Hash]; ok {
+			return false
+		}
+		names[view.Hash] = fmt.Sprintf("Hash%v", len(order))
+		order = append(order, view.Hash)
+		return true
+	})
+	rs := ""
+	for _, hash := range order {
+		// same node, child hashes swapped for their names
+		node := mpt.getNode(hash)
+		if node.node_type == 1 {
+			for i := 0; i < 16; i++ {
+				if node.branch_value[i] != "" {
+					node.branch_value[i] = names[node.branch_value[i]]
+				}
+			}
+		} else if is_ext_node(node.flag_value.encoded_prefix) {
+			node.flag_value.value = names[node.flag_value.value]
+		}
+		rs += names[hash] + ": " + node.String() + "\n"
+	}
+	return rs
+}
+
+// Dot draws the trie in Graphviz format, render it with e.g. dot -Tsvg.
+// Nodes are named by the first 8 hex digits of their hash, edges by branch slot.
+func (mpt *MerklePatriciaTrie) Dot() (string, error) {
+	lines := []string{"digraph mpt {", "\tnode [shape=box, fontname=monospace];"}
+	seen := map[string]bool{}
+	err := mpt.Walk(func(view NodeView) bool {
+		if seen[view.Hash] {
+			return false
+		}
+		seen[view.Hash] = true
+		label := view.Kind.String() + " " + view.Hash[:8]
+		if len(view.Prefix) != 0 {
+			label += "\\nprefix " + nibbles_to_string(view.Prefix)
+		}
+		if view.Value != "" {
+			label += "\\nvalue " + dot_escape(view.Value)
+		}
+		lines = append(lines, fmt.Sprintf("\t%q [label=\"%s\"];", view.Hash, label))
+		for _, child := range view.Children {
+			edge := fmt.Sprintf("\t%q -> %q", view.Hash, child.Hash)
+			if child.Nibble >= 0 {
+				edge += fmt.Sprintf(" [label=\"%x\"]", child.Nibble)
+			}
+			lines = append(lines, edge+";")
+		}
+		return true
+	})
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n") + "\n", err
+}
+
+func nibbles_to_string(path []uint8) string {
+	str := ""
+	for _, nibble := range path {
+		str += fmt.Sprintf("%x", nibble)
+	}
+	return str
+}
+
+// quote a value for a DOT label, keeping it on one line
+func dot_escape(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,109 @@
+package p1
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func inspect_trie() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, key := range []string{"a", "ab", "abc", "b", "choice/A", "choice/B"} {
+		mpt.Insert(key, "v"+key)
+	}
+	return mpt
+}
+
+// the views of Nodes give back the nodes and the keys of the trie
+func TestNodes(t *testing.T) {
+	mpt := inspect_trie()
+	views, err := mpt.Nodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]bool{}
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, view := range views {
+		hashes[view.Hash] = true
+		node, _ := mpt.db.Get(view.Hash)
+		if NodeKind(node.Encode()[0]) != view.Kind {
+			t.Errorf("node %s is a %v, view says %v", view.Hash, NodeKind(node.Encode()[0]), view.Kind)
+		}
+		for _, child := range view.Children {
+			if seen[child.Hash] {
+				t.Errorf("child %s visited before its parent", child.Hash)
+			}
+		}
+		seen[view.Hash] = true
+		if key, ok := view.Key(); ok {
+			if view.Value != "v"+key {
+				t.Errorf("view of %q has value %q", key, view.Value)
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(hashes) != len(mpt.ExportNodes().Nodes) {
+		t.Errorf("%d nodes visited, the trie has %d", len(hashes), len(mpt.ExportNodes().Nodes))
+	}
+	want := []string{"a", "ab", "abc", "b", "choice/A", "choice/B"}
+	if sort.Strings(keys); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %v, want %v", keys, want)
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	mpt := inspect_trie()
+	count := 0
+	err := mpt.Walk(func(view NodeView) bool {
+		count++
+		return view.Depth == 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := mpt.db.Get(mpt.root)
+	if want := 1 + len(children(root)); count != want {
+		t.Errorf("visited %d nodes, want the root and its %d children", count, want-1)
+	}
+
+	mpt.db.Delete(children(root)[0])
+	if err := mpt.Walk(func(view NodeView) bool { return true }); err == nil {
+		t.Error("walked a trie with a missing node")
+	}
+}
+
+func TestOrderNodesAndDot(t *testing.T) {
+	mpt := inspect_trie()
+	nodes := len(mpt.ExportNodes().Nodes)
+	lines := strings.Split(strings.TrimSpace(mpt.Order_nodes()), "\n")
+	if len(lines) != nodes || !strings.HasPrefix(lines[0], "Hash0: ") {
+		t.Errorf("Order_nodes gave %d lines for %d nodes:\n%s", len(lines), nodes, mpt.Order_nodes())
+	}
+	dot, err := mpt.Dot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(dot, "digraph mpt {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("not a graph:\n%s", dot)
+	}
+	labels, edges := 0, 0
+	for _, line := range strings.Split(dot, "\n") {
+		if strings.Contains(line, "->") {
+			edges++
+		} else if strings.Contains(line, "[label=") {
+			labels++
+		}
+	}
+	// every node but the root is the child of exactly one edge in this trie
+	if labels != nodes || edges != nodes-1 {
+		t.Errorf("%d nodes and %d edges for %d nodes:\n%s", labels, edges, nodes, dot)
+	}
+	empty := MerklePatriciaTrie{}
+	empty.Initial()
+	if empty.Order_nodes() != "empty" {
+		t.Errorf("empty trie: %q", empty.Order_nodes())
+	}
+}
@@ -0,0 +1,165 @@
+package p1
+
+import "errors"
+
+// KeyValue is one entry of the trie, as returned by Prefix and Range
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Iterator walks the trie depth first in nibble order, which is the byte order of the keys.
+// A key that ends at a branch comes before every key that continues below that branch.
+// A key stored with an empty value is skipped, Get reports it as missing too.
+//
+//	it := mpt.NewIterator()
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Value())
+//	}
+type Iterator struct {
+	mpt   *MerklePatriciaTrie
+	stack []iterFrame
+	start []uint8
+	key   string
+	value string
+	err   error
+}
+
+// a node still to visit and the path leading to it
+type iterFrame struct {
+	hash string
+	path []uint8
+}
+
+func (mpt *MerklePatriciaTrie) NewIterator() *Iterator {
+	return mpt.NewIteratorFrom("")
+}
+
+// NewIteratorFrom starts at the first key that is not smaller than start,
+// subtrees that only hold smaller keys are skipped without being read
+func (mpt *MerklePatriciaTrie) NewIteratorFrom(start string) *Iterator {
+	it := &Iterator{mpt: mpt, start: string2hexarray(start)}
+	if mpt.root != "" {
+		it.stack = append(it.stack, iterFrame{hash: mpt.root, path: []uint8{}})
+	}
+	return it
+}
+
+// Next moves to the next key, it returns false at the end or on a missing node
+func (it *Iterator) Next() bool {
+	for it.err == nil && len(it.stack) != 0 {
+		last_index := len(it.stack) - 1
+		frame := it.stack[last_index]
+		it.stack = it.stack[:last_index]
+		if compare_path(frame.path, it.start[:min_len(frame.path, it.start)]) < 0 {
+			continue
+		}
+		node, ok := it.mpt.db.Get(frame.hash)
+		if !ok {
+			it.err = errors.New("missing_node")
+			return false
+		}
+		switch node.node_type {
+		case 1: // Branch
+			for i := 15; i >= 0; i-- {
+				if node.branch_value[i] != "" {
+					path := join_path(frame.path, []uint8{uint8(i)})
+					it.stack = append(it.stack, iterFrame{hash: node.branch_value[i], path: path})
+				}
+			}
+			if node.branch_value[16] != "" && it.emit(frame.path, node.branch_value[16]) {
+				return true
+			}
+		case 2: // Ext or Leaf
+			path := join_path(frame.path, compact_decode(node.flag_value.encoded_prefix))
+			if !is_leaf(node.flag_value.encoded_prefix) {
+				it.stack = append(it.stack, iterFrame{hash: node.flag_value.value, path: path})
+			} else if node.flag_value.value != "" && it.emit(path, node.flag_value.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emit sets the current entry if path is not before the start key
+func (it *Iterator) emit(path []uint8, value string) bool {
+	if compare_path(path, it.start) < 0 {
+		return false
+	}
+	key, ok := hexarray2string(path)
+	if !ok {
+		it.err = errors.New("odd_key_path")
+		return false
+	}
+	it.key = key
+	it.value = value
+	return true
+}
+
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Prefix returns every entry whose key starts with prefix, in key order,
+// e.g. Prefix("choice/") for "choice/A" and "choice/B"
+func (mpt *MerklePatriciaTrie) Prefix(prefix string) ([]KeyValue, error) {
+	ret := []KeyValue{}
+	path := string2hexarray(prefix)
+	it := mpt.NewIteratorFrom(prefix)
+	for it.Next() {
+		if eq_len(string2hexarray(it.Key()), path) != len(path) {
+			break
+		}
+		ret = append(ret, KeyValue{Key: it.Key(), Value: it.Value()})
+	}
+	return ret, it.Err()
+}
+
+// Range returns the entries with start <= key < end in key order, an empty end has no upper bound
+func (mpt *MerklePatriciaTrie) Range(start string, end string) ([]KeyValue, error) {
+	ret := []KeyValue{}
+	it := mpt.NewIteratorFrom(start)
+	for it.Next() {
+		if end != "" && it.Key() >= end {
+			break
+		}
+		ret = append(ret, KeyValue{Key: it.Key(), Value: it.Value()})
+	}
+	return ret, it.Err()
+}
+
+// compare two nibble paths in order, a path comes before every longer path it is a prefix of
+func compare_path(a, b []uint8) int {
+	size := min_len(a, b)
+	for i := 0; i < size; i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	if len(a) == len(b) {
+		return 0
+	}
+	if len(a) < len(b) {
+		return -1
+	}
+	return 1
+}
+
+func min_len(a, b []uint8) int {
+	if len(a) < len(b) {
+		return len(a)
+	}
+	return len(b)
+}
@@ -0,0 +1,90 @@
+package p1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func iterator_trie() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, key := range []string{"hint/1", "choice/B", "choice", "choice/A", "hint/2", "react", "choice/AB"} {
+		mpt.Insert(key, "v"+key)
+	}
+	return mpt
+}
+
+func keys_of(entries []KeyValue) []string {
+	ret := []string{}
+	for _, entry := range entries {
+		if entry.Value != "v"+entry.Key {
+			return append(ret, "bad value for "+entry.Key)
+		}
+		ret = append(ret, entry.Key)
+	}
+	return ret
+}
+
+func TestPrefix(t *testing.T) {
+	mpt := iterator_trie()
+	cases := map[string][]string{
+		"choice/": {"choice/A", "choice/AB", "choice/B"},
+		"choice":  {"choice", "choice/A", "choice/AB", "choice/B"},
+		"hint/":   {"hint/1", "hint/2"},
+		"r":       {"react"},
+		"x":       {},
+		"":        {"choice", "choice/A", "choice/AB", "choice/B", "hint/1", "hint/2", "react"},
+	}
+	for prefix, want := range cases {
+		entries, err := mpt.Prefix(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys_of(entries); !reflect.DeepEqual(got, want) {
+			t.Errorf("prefix %q = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	mpt := iterator_trie()
+	cases := []struct {
+		start, end string
+		want       []string
+	}{
+		{"choice/A", "choice/B", []string{"choice/A", "choice/AB"}},
+		{"choice/AA", "hint/2", []string{"choice/AB", "choice/B", "hint/1"}},
+		{"hint/", "", []string{"hint/1", "hint/2", "react"}},
+		{"", "choice/", []string{"choice"}},
+		{"s", "", []string{}},
+	}
+	for _, c := range cases {
+		entries, err := mpt.Range(c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys_of(entries); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("range %q to %q = %v, want %v", c.start, c.end, got, c.want)
+		}
+	}
+}
+
+// a key with an empty value is missing for Get, the iterator must not list it either
+func TestIteratorSkipsEmptyValues(t *testing.T) {
+	mpt := iterator_trie()
+	mpt.Insert("hint/3", "")
+	mpt.Insert("choice/A", "")
+	it := mpt.NewIterator()
+	for it.Next() {
+		if _, err := mpt.Get(it.Key()); err != nil {
+			t.Errorf("iterator lists %q, get says %v", it.Key(), err)
+		}
+	}
+	entries, err := mpt.Prefix("hint/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys_of(entries); !reflect.DeepEqual(got, []string{"hint/1", "hint/2"}) {
+		t.Errorf("prefix hint/ = %v", got)
+	}
+}
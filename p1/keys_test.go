@@ -0,0 +1,46 @@
+package p1
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// "\u4e8b" and "\u0e8b" used to get the same path
+var unicode_keys = []string{"故事", "敀事", "\u4e8b", "\u0e8b", "\u018b", "😀", "😁", "\x00", "\x00\x00", "\xff"}
+
+func TestUnicodeKeysDistinctPaths(t *testing.T) {
+	paths := map[string]string{}
+	for _, key := range unicode_keys {
+		path := fmt.Sprint(string2hexarray(key))
+		if other, ok := paths[path]; ok {
+			t.Errorf("%q and %q have the same path %s", other, key, path)
+		}
+		paths[path] = key
+	}
+}
+
+func TestUnicodeKeysKeepTheirValues(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for i, key := range unicode_keys {
+		mpt.InsertBytes([]byte(key), fmt.Sprint(i))
+	}
+	for i, key := range unicode_keys {
+		if value, err := mpt.GetBytes([]byte(key)); err != nil || value != fmt.Sprint(i) {
+			t.Errorf("get %q = %q, %v, want %d", key, value, err, i)
+		}
+	}
+	it := mpt.NewIterator()
+	count := 0
+	for it.Next() {
+		count++
+		i, err := strconv.Atoi(it.Value())
+		if err != nil || it.Key() != unicode_keys[i] {
+			t.Errorf("iterator gave %q with value %q", it.Key(), it.Value())
+		}
+	}
+	if count != len(unicode_keys) {
+		t.Errorf("iterator gave %d keys, want %d", count, len(unicode_keys))
+	}
+}
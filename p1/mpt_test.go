@@ -0,0 +1,133 @@
+package p1
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Property checks of the trie against a plain map. The keys come from a tiny alphabet so
+// random operations keep hitting shared prefixes, splits and merges.
+
+var fuzz_alphabet = []byte{0x00, 0x01, 0x10, 0x11, 'a', 'b', 0xff}
+
+// run_ops runs the operations encoded in data against a trie and a map and fails as soon
+// as they disagree. Each operation takes 2 bytes: the first picks insert or delete and the
+// key length (1 to 3), the second the key bytes and the value.
+func run_ops(t *testing.T, data []byte) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	ref := map[string]string{}
+	for i := 0; i+1 < len(data); i += 2 {
+		op, arg := data[i], data[i+1]
+		key := []byte{}
+		for j := 0; j <= int(op>>1)%3; j++ {
+			key = append(key, fuzz_alphabet[(int(arg)+j*int(op))%len(fuzz_alphabet)])
+		}
+		if op&1 == 0 {
+			value := fmt.Sprint(arg % 4)
+			mpt.Insert(string(key), value)
+			ref[string(key)] = value
+		} else {
+			_, err := mpt.Delete(string(key))
+			if _, ok := ref[string(key)]; (err == nil) != ok {
+				t.Fatalf("op %d: delete %x returned %v, key present %v", i/2, key, err, ok)
+			}
+			delete(ref, string(key))
+		}
+		check_content(t, &mpt, ref)
+	}
+	check_properties(t, &mpt, ref)
+}
+
+// the trie holds exactly the pairs of ref, and they come out of the iterator in key order
+func check_content(t *testing.T, mpt *MerklePatriciaTrie, ref map[string]string) {
+	keys := []string{}
+	for key, value := range ref {
+		if got, err := mpt.Get(key); err != nil || got != value {
+			t.Fatalf("get %x = %q, %v, want %q", key, got, err, value)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	it := mpt.NewIterator()
+	i := 0
+	for it.Next() {
+		if i == len(keys) || it.Key() != keys[i] || it.Value() != ref[keys[i]] {
+			t.Fatalf("iterator gave %x at position %d", it.Key(), i)
+		}
+		i++
+	}
+	if it.Err() != nil || i != len(keys) {
+		t.Fatalf("iterator stopped after %d of %d keys: %v", i, len(keys), it.Err())
+	}
+	if len(keys) == 0 && mpt.root != "" {
+		t.Fatalf("empty trie has root %s", mpt.root)
+	}
+}
+
+// the root only depends on the content: any insert order and a batch reach it, deleting
+// and re-inserting a key comes back to it
+func check_properties(t *testing.T, mpt *MerklePatriciaTrie, ref map[string]string) {
+	keys := []string{}
+	for key := range ref {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for round := 0; round < 3; round++ {
+		other := MerklePatriciaTrie{}
+		other.Initial()
+		for _, i := range rand.Perm(len(keys)) {
+			other.Insert(keys[i], ref[keys[i]])
+		}
+		if other.root != mpt.root {
+			t.Fatalf("insert order changed the root: %s, want %s", other.root, mpt.root)
+		}
+	}
+	batched := MerklePatriciaTrie{}
+	batched.Initial()
+	batch := batched.NewBatch()
+	for _, key := range keys {
+		batch.Put(key, ref[key])
+	}
+	if root, err := batch.Commit(); err != nil || root != mpt.root {
+		t.Fatalf("batch root %s, %v, want %s", root, err, mpt.root)
+	}
+	root := mpt.root
+	for _, key := range keys {
+		mpt.Delete(key)
+		if got := mpt.Insert(key, ref[key]); got != root {
+			t.Fatalf("delete and insert of %x moved the root to %s", key, got)
+		}
+	}
+	for _, i := range rand.Perm(len(keys)) {
+		mpt.Delete(keys[i])
+	}
+	if mpt.root != "" {
+		t.Fatalf("root %s after deleting every key", mpt.root)
+	}
+}
+
+func TestProperties(t *testing.T) {
+	for _, seed := range []int64{1, 2} {
+		r := rand.New(rand.NewSource(seed))
+		for round := 0; round < 200; round++ {
+			data := make([]byte, 2*r.Intn(64))
+			r.Read(data)
+			t.Run(fmt.Sprintf("seed%d/%d", seed, round), func(t *testing.T) {
+				run_ops(t, data)
+			})
+		}
+	}
+}
+
+func FuzzOps(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 4, 0, 5, 2, 4, 1, 4, 3, 4})
+	f.Add([]byte{0, 0, 2, 0, 4, 0, 1, 0, 3, 0, 5, 0})
+	f.Add([]byte{0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 1, 3, 1, 4})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		run_ops(t, data)
+	})
+}
@@ -0,0 +1,150 @@
+package p1
+
+import "errors"
+
+// Proof is the list of encoded nodes visited from the root down to the node holding a key.
+// A light client only needs the proof and the root hash to check a value.
+type Proof [][]byte
+
+// Prove collects the nodes on the path of key, starting at mpt.root.
+func (mpt *MerklePatriciaTrie) Prove(key string) (Proof, error) {
+	if key == "" {
+		return nil, errors.New("path_not_found")
+	}
+	proof, value, err := mpt.provePath(string2hexarray(key))
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, errors.New("path_not_found")
+	}
+	return proof, nil
+}
+
+// ProveAbsence collects the nodes on the path of key down to the branch, extension
+// or leaf where the path diverges, proving that key is not stored under mpt.root.
+func (mpt *MerklePatriciaTrie) ProveAbsence(key string) (Proof, error) {
+	proof, value, err := mpt.provePath(string2hexarray(key))
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		return nil, errors.New("key_exists")
+	}
+	return proof, nil
+}
+
+// provePath walks path from the root and returns every visited node, plus the value
+// at the end of the path or "" if the path diverges.
+func (mpt *MerklePatriciaTrie) provePath(path []uint8) (Proof, string, error) {
+	proof := Proof{}
+	cur_hash := mpt.root
+	for cur_hash != "" {
+		node, ok := mpt.db.Get(cur_hash)
+		if !ok {
+			return nil, "", errors.New("missing_node")
+		}
+		proof = append(proof, node.Encode())
+		switch node.node_type {
+		case 1: // Branch
+			if len(path) == 0 {
+				return proof, node.branch_value[16], nil
+			}
+			cur_hash = node.branch_value[path[0]]
+			path = path[1:]
+		case 2: // Ext or Leaf
+			decoded := compact_decode(node.flag_value.encoded_prefix)
+			if is_leaf(node.flag_value.encoded_prefix) {
+				if !equal_path(decoded, path) {
+					return proof, "", nil
+				}
+				return proof, node.flag_value.value, nil
+			}
+			if len(decoded) > len(path) || eq_len(decoded, path) != len(decoded) {
+				return proof, "", nil
+			}
+			cur_hash = node.flag_value.value
+			path = path[len(decoded):]
+		default:
+			return nil, "", errors.New("missing_node")
+		}
+	}
+	return proof, "", nil
+}
+
+// VerifyProof checks that key maps to value under root, using only the nodes in proof.
+// Every node must hash to the reference held by its parent, and the proof must end
+// exactly at the node holding the value.
+func VerifyProof(root string, key string, value string, proof Proof) bool {
+	if value == "" {
+		return false
+	}
+	found, ok := walkProof(root, string2hexarray(key), proof)
+	return ok && found == value
+}
+
+// VerifyAbsence checks that key is not stored under root. The proof must end at the
+// node where the path of key diverges: an empty branch slot, a branch without value,
+// or an extension/leaf whose prefix does not match.
+func VerifyAbsence(root string, key string, proof Proof) bool {
+	found, ok := walkProof(root, string2hexarray(key), proof)
+	return ok && found == ""
+}
+
+// walkProof follows path through the proof nodes and returns the value at the end of it,
+// or "" if the path diverges at the last node. ok is false when the proof does not hash
+// up to root or does not stop exactly where the path ends.
+func walkProof(root string, path []uint8, proof Proof) (string, bool) {
+	expected := root
+	for i, encoded := range proof {
+		if expected == "" || HashOf(encoded) != expected {
+			return "", false
+		}
+		node, err := DecodeNode(encoded)
+		if err != nil {
+			return "", false
+		}
+		last := i == len(proof)-1
+		switch node.node_type {
+		case 1: // Branch
+			if len(path) == 0 {
+				return node.branch_value[16], last
+			}
+			expected = node.branch_value[path[0]]
+			path = path[1:]
+			if expected == "" {
+				return "", last
+			}
+		case 2: // Ext or Leaf
+			decoded := compact_decode(node.flag_value.encoded_prefix)
+			if is_leaf(node.flag_value.encoded_prefix) {
+				if !equal_path(decoded, path) {
+					return "", last
+				}
+				return node.flag_value.value, last
+			}
+			if len(decoded) > len(path) || eq_len(decoded, path) != len(decoded) {
+				return "", last
+			}
+			expected = node.flag_value.value
+			path = path[len(decoded):]
+		default:
+			return "", false
+		}
+	}
+	// an empty trie proves every key absent with an empty proof
+	return "", root == "" && len(proof) == 0
+}
+
+// judge if two nibble paths are exactly the same
+func equal_path(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package p1
+
+import "testing"
+
+func proof_trie() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("content", "question")
+	mpt.Insert("react", "answer")
+	mpt.Insert("reaction", "smile")
+	mpt.Insert("hint", "none")
+	return mpt
+}
+
+func TestProofVerifies(t *testing.T) {
+	mpt := proof_trie()
+	for _, key := range []string{"content", "react", "reaction", "hint"} {
+		value, _ := mpt.Get(key)
+		proof, err := mpt.Prove(key)
+		if err != nil {
+			t.Fatalf("prove %s: %v", key, err)
+		}
+		if !VerifyProof(mpt.Get_root(), key, value, proof) {
+			t.Errorf("proof of %s = %q does not verify", key, value)
+		}
+	}
+}
+
+func TestProofRejectsWrongValue(t *testing.T) {
+	mpt := proof_trie()
+	proof, err := mpt.Prove("react")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyProof(mpt.Get_root(), "react", "smile", proof) {
+		t.Error("proof verifies a wrong value")
+	}
+	if VerifyProof(mpt.Get_root(), "reaction", "answer", proof) {
+		t.Error("proof verifies another key")
+	}
+}
+
+func TestProofRejectsTamperedNode(t *testing.T) {
+	mpt := proof_trie()
+	proof, err := mpt.Prove("react")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range proof {
+		tampered := append(Proof{}, proof...)
+		tampered[i] = append([]byte{}, proof[i]...)
+		tampered[i][len(tampered[i])-1] ^= 1
+		if VerifyProof(mpt.Get_root(), "react", "answer", tampered) {
+			t.Errorf("proof verifies with node %d tampered", i)
+		}
+	}
+	if VerifyProof(mpt.Get_root(), "react", "answer", proof[:len(proof)-1]) {
+		t.Error("proof verifies without its last node")
+	}
+}
+
+func TestProofRejectsWrongRoot(t *testing.T) {
+	mpt := proof_trie()
+	proof, err := mpt.Prove("react")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := proof_trie()
+	other.Insert("react", "changed")
+	if VerifyProof(other.Get_root(), "react", "answer", proof) {
+		t.Error("proof verifies against another root")
+	}
+	if VerifyProof("", "react", "answer", proof) {
+		t.Error("proof verifies against an empty root")
+	}
+}
+
+func TestAbsenceProofVerifies(t *testing.T) {
+	mpt := proof_trie()
+	for _, key := range []string{"reac", "reacts", "content2", "hin", "zzz"} {
+		proof, err := mpt.ProveAbsence(key)
+		if err != nil {
+			t.Fatalf("prove absence of %s: %v", key, err)
+		}
+		if !VerifyAbsence(mpt.Get_root(), key, proof) {
+			t.Errorf("absence proof of %s does not verify", key)
+		}
+		if VerifyProof(mpt.Get_root(), key, "answer", proof) {
+			t.Errorf("absence proof of %s verifies a value", key)
+		}
+	}
+}
+
+func TestAbsenceProofRejectsPresentKey(t *testing.T) {
+	mpt := proof_trie()
+	if _, err := mpt.ProveAbsence("react"); err == nil {
+		t.Error("absence of a stored key was proven")
+	}
+	proof, err := mpt.Prove("react")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyAbsence(mpt.Get_root(), "react", proof) {
+		t.Error("inclusion proof verifies as absence")
+	}
+	absent, err := mpt.ProveAbsence("reac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyAbsence(mpt.Get_root(), "react", absent) {
+		t.Error("absence proof of another key verifies for a stored key")
+	}
+}
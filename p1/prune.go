@@ -0,0 +1,104 @@
+package p1
+
+import "errors"
+
+// PruneStats tells what a pruning run found in the store
+type PruneStats struct {
+	Scanned     int // nodes in the store before the run
+	Reachable   int // nodes reachable from a retained root
+	Unreachable int // nodes no retained root reaches
+	Removed     int // nodes deleted by this run
+}
+
+// Prune deletes every node of store that none of roots reaches. It must not run while
+// another trie is being built in the same store, use a Pruner for that.
+func Prune(store NodeStore, roots ...string) (PruneStats, error) {
+	pruner := NewPruner(store)
+	pruner.grace = false
+	return pruner.Prune(roots...)
+}
+
+// Prune keeps the current root and every root in retain (older snapshots, other blocks)
+func (mpt *MerklePatriciaTrie) Prune(retain ...string) (PruneStats, error) {
+	return Prune(mpt.db, append([]string{mpt.root}, retain...)...)
+}
+
+// Pruner collects garbage in a store shared by tries that are still being built, whose
+// roots are not retained yet. Every node put since the previous run, a node some new trie
+// reused included, is kept with everything below it. So a trie built since the previous
+// run survives this one, and a node stays in the store as long as it keeps being put.
+type Pruner struct {
+	store      NodeStore
+	generation uint64
+	grace      bool
+}
+
+func NewPruner(store NodeStore) *Pruner {
+	return &Pruner{store: store, grace: true}
+}
+
+func (pruner *Pruner) Prune(roots ...string) (PruneStats, error) {
+	start := pruner.store.Generation()
+	stats := PruneStats{}
+	fresh := []string{}
+	pruner.store.Range(func(hash string, node Node) {
+		stats.Scanned++
+		if pruner.grace && pruner.store.LastPut(hash) > pruner.generation {
+			fresh = append(fresh, hash)
+		}
+	})
+	reachable := map[string]bool{}
+	if err := pruner.mark(reachable, roots, true); err != nil {
+		return stats, err
+	}
+	// a trie still being built may not have all its nodes yet
+	pruner.mark(reachable, fresh, false)
+	stats.Reachable = len(reachable)
+
+	unreachable := []string{}
+	pruner.store.Range(func(hash string, node Node) {
+		if !reachable[hash] {
+			unreachable = append(unreachable, hash)
+		}
+	})
+	stats.Unreachable = len(unreachable)
+	for _, hash := range unreachable {
+		if pruner.grace && pruner.store.LastPut(hash) > start {
+			// put again while this run was walking the store
+			continue
+		}
+		if err := pruner.store.Delete(hash); err != nil {
+			return stats, err
+		}
+		stats.Removed++
+	}
+	pruner.generation = start
+	return stats, nil
+}
+
+// mark adds every node below hashes to reachable, a missing node is an error if strict
+func (pruner *Pruner) mark(reachable map[string]bool, hashes []string, strict bool) error {
+	queue := []string{}
+	for _, hash := range hashes {
+		if hash != "" {
+			queue = append(queue, hash)
+		}
+	}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if reachable[hash] {
+			continue
+		}
+		node, ok := pruner.store.Get(hash)
+		if !ok {
+			if strict {
+				return errors.New("missing_node")
+			}
+			continue
+		}
+		reachable[hash] = true
+		queue = append(queue, children(node)...)
+	}
+	return nil
+}
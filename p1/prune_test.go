@@ -0,0 +1,137 @@
+package p1
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPruneKeepsRetainedRoots(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("aa", "1")
+	mpt.Insert("ab", "2")
+	mpt.Insert("ab", "3")
+	mpt.Delete("aa")
+	before := mpt.db.Len()
+	stats, err := mpt.Prune()
+	if err != nil || stats.Removed == 0 || mpt.db.Len() != before-stats.Removed {
+		t.Fatalf("prune: %+v, %v", stats, err)
+	}
+	if value, err := mpt.Get("ab"); err != nil || value != "3" {
+		t.Fatalf("get ab = %q, %v", value, err)
+	}
+}
+
+func TestPrunerGrace(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("x", "1")
+	root := mpt.root
+	mpt.Insert("y", "2")
+	pruner := NewPruner(mpt.db)
+	if stats, err := pruner.Prune(root); err != nil || stats.Removed != 0 {
+		t.Fatalf("first run removed a new trie: %+v, %v", stats, err)
+	}
+	if stats, err := pruner.Prune(root); err != nil || stats.Removed == 0 {
+		t.Fatalf("second run kept an unused trie: %+v, %v", stats, err)
+	}
+	if value, err := mpt.Get("x"); err == nil {
+		t.Fatalf("get x = %q from a pruned trie", value)
+	}
+}
+
+// a new trie reuses the nodes of an unused one, they must not be deleted under it
+func TestPrunerKeepsReusedNodes(t *testing.T) {
+	store := NewMemoryStore()
+	pruner := NewPruner(store)
+	a := MerklePatriciaTrie{}
+	a.InitialWithStore(store)
+	a.Insert("xa", "1")
+	a.Insert("xb", "2")
+	a.Insert("xc", "3")
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := MerklePatriciaTrie{}
+	b.InitialWithStore(store)
+	b.Insert("xa", "1")
+	b.Insert("xb", "2")
+	b.Insert("xc", "3")
+	b.Insert("y", "4")
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"xa": "1", "xb": "2", "xc": "3", "y": "4"} {
+		if value, err := b.Get(key); err != nil || value != want {
+			t.Fatalf("get %s = %q, %v after pruning", key, value, err)
+		}
+	}
+	if _, err := b.Prune(); err != nil {
+		t.Fatalf("b is not whole: %v", err)
+	}
+}
+
+// a trie built on top of an unused one reaches its nodes without putting them again
+func TestPrunerKeepsSharedSubtrees(t *testing.T) {
+	store := temp_file_store(t)
+	pruner := NewPruner(store)
+	a := MerklePatriciaTrie{}
+	a.InitialWithStore(store)
+	a.Insert("xa", "1")
+	a.Insert("xb", "2")
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	b := a.Snapshot()
+	b.Insert("y", "3")
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pruner.Prune(b.root); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := b.Get("xa"); err != nil || value != "1" {
+		t.Fatalf("get xa = %q, %v after pruning", value, err)
+	}
+}
+
+func temp_file_store(t *testing.T) *FileStore {
+	store, err := NewFileStore(t.TempDir() + "/nodes.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// a block whose trie is already in the store as garbage gets it from SyncTrie without
+// fetching anything, the next run must not delete it before the block is inserted
+func TestPrunerKeepsSyncedReusedRoot(t *testing.T) {
+	store := NewMemoryStore()
+	pruner := NewPruner(store)
+	a := MerklePatriciaTrie{}
+	a.InitialWithStore(store)
+	a.Insert("xa", "1")
+	a.Insert("xb", "2")
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	no_fetch := func(hash string) ([]byte, error) {
+		return nil, errors.New("no_node_source")
+	}
+	b, err := SyncTrie(store, a.root, no_fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pruner.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := b.Get("xb"); err != nil || value != "2" {
+		t.Fatalf("get xb = %q, %v after pruning", value, err)
+	}
+	if _, err := pruner.Prune(b.root); err != nil {
+		t.Fatalf("b is not whole: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package p1
+
+// Snapshot returns the current version of the trie. It keeps pointing at today's root
+// whatever is inserted into or deleted from mpt afterwards.
+func (mpt *MerklePatriciaTrie) Snapshot() MerklePatriciaTrie {
+	return MerklePatriciaTrie{db: mpt.db, root: mpt.root}
+}
+
+// At opens an older (or any other) version of the trie by its root hash. The nodes of
+// that version must still be in the store, see Insert and Delete for the roots.
+func (mpt *MerklePatriciaTrie) At(root string) (MerklePatriciaTrie, error) {
+	return OpenTrie(mpt.db, root)
+}
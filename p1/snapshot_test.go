@@ -0,0 +1,58 @@
+package p1
+
+import "testing"
+
+func check_get(t *testing.T, name string, mpt *MerklePatriciaTrie, want map[string]string) {
+	t.Helper()
+	for key, value := range want {
+		got, err := mpt.Get(key)
+		if value == "" {
+			if err == nil {
+				t.Errorf("%s: get %s = %q, want missing", name, key, got)
+			}
+		} else if err != nil || got != value {
+			t.Errorf("%s: get %s = %q, %v, want %q", name, key, got, err, value)
+		}
+	}
+}
+
+func TestSnapshotKeepsOldValues(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("a", "1")
+	mpt.Insert("ab", "2")
+	first := mpt.Snapshot()
+	first_root := mpt.Get_root()
+
+	mpt.Insert("a", "changed")
+	mpt.Delete("ab")
+	mpt.Insert("b", "3")
+	second := mpt.Snapshot()
+	mpt.Delete("a")
+	mpt.Delete("b")
+
+	check_get(t, "first", &first, map[string]string{"a": "1", "ab": "2", "b": ""})
+	check_get(t, "second", &second, map[string]string{"a": "changed", "ab": "", "b": "3"})
+	check_get(t, "current", &mpt, map[string]string{"a": "", "ab": "", "b": ""})
+
+	at, err := mpt.At(first_root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_get(t, "at", &at, map[string]string{"a": "1", "ab": "2", "b": ""})
+	if _, err := mpt.At(HashOf([]byte("no such root"))); err == nil {
+		t.Error("opened a root that is not in the store")
+	}
+}
+
+// inserting into a snapshot leaves the trie it was taken from alone
+func TestSnapshotIsIndependent(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("a", "1")
+	snapshot := mpt.Snapshot()
+	snapshot.Insert("a", "2")
+	snapshot.Insert("c", "3")
+	check_get(t, "trie", &mpt, map[string]string{"a": "1", "c": ""})
+	check_get(t, "snapshot", &snapshot, map[string]string{"a": "2", "c": "3"})
+}
@@ -0,0 +1,278 @@
+package p1
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// NodeStore keeps the nodes of one or more tries, keyed by node hash.
+// Nodes are content addressed, so several tries can share one store and
+// every node they have in common is only stored once.
+type NodeStore interface {
+	Get(hash string) (Node, bool)
+	Put(hash string, node Node) error
+	Delete(hash string) error
+	Len() int
+	Range(fn func(hash string, node Node))
+	// Generation counts the puts so far and LastPut the count at which hash was last put,
+	// a put of a node the store already has included. See Pruner.
+	Generation() uint64
+	LastPut(hash string) uint64
+}
+
+//=================================== in-memory store ===================================
+// MemoryStore is the map based store every trie used before stores existed
+type MemoryStore struct {
+	nodes      map[string]Node
+	puts       map[string]uint64
+	generation uint64
+	mux        sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nodes: make(map[string]Node), puts: make(map[string]uint64)}
+}
+
+func (store *MemoryStore) Get(hash string) (Node, bool) {
+	store.mux.RLock()
+	defer store.mux.RUnlock()
+	node, ok := store.nodes[hash]
+	return node, ok
+}
+
+func (store *MemoryStore) Put(hash string, node Node) error {
+	store.mux.Lock()
+	store.nodes[hash] = node
+	store.generation++
+	store.puts[hash] = store.generation
+	store.mux.Unlock()
+	return nil
+}
+
+func (store *MemoryStore) Delete(hash string) error {
+	store.mux.Lock()
+	delete(store.nodes, hash)
+	delete(store.puts, hash)
+	store.mux.Unlock()
+	return nil
+}
+
+func (store *MemoryStore) Generation() uint64 {
+	store.mux.RLock()
+	defer store.mux.RUnlock()
+	return store.generation
+}
+
+func (store *MemoryStore) LastPut(hash string) uint64 {
+	store.mux.RLock()
+	defer store.mux.RUnlock()
+	return store.puts[hash]
+}
+
+func (store *MemoryStore) Len() int {
+	store.mux.RLock()
+	defer store.mux.RUnlock()
+	return len(store.nodes)
+}
+
+func (store *MemoryStore) Range(fn func(hash string, node Node)) {
+	store.mux.RLock()
+	nodes := make(map[string]Node, len(store.nodes))
+	for k, v := range store.nodes {
+		nodes[k] = v
+	}
+	store.mux.RUnlock()
+	for k, v := range nodes {
+		fn(k, v)
+	}
+}
+
+//=================================== file store ===================================
+// FileStore is an append-only log of node records. A record is one op byte followed by a
+// length prefixed payload: 'P' and the canonical encoding of a node, or 'D' and the raw hash
+// of a deleted node. The whole log is replayed into memory when the file is opened, and every
+// Put or Delete is appended before it becomes visible, so a trie can be reopened from its
+// root hash after a restart.
+type FileStore struct {
+	cache *MemoryStore
+	file  *os.File
+	mux   sync.Mutex
+}
+
+const (
+	record_put    = 'P'
+	record_delete = 'D'
+)
+
+// MAX_RECORD_SIZE bounds a record, so a corrupt length cannot make replay allocate gigabytes
+const MAX_RECORD_SIZE = 64 << 20
+
+// NewFileStore opens (or creates) the log at path and replays it.
+// A half written record at the end of the log, left by a crash, is cut off. A record
+// in the middle of the log that cannot be read is an error, the log is left as it is.
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{cache: NewMemoryStore(), file: file}
+	valid, err := store.replay()
+	if err == nil {
+		err = file.Truncate(valid)
+	}
+	if err == nil {
+		_, err = file.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// replay loads every complete record and returns the offset right after the last one
+func (store *FileStore) replay() (int64, error) {
+	reader := bufio.NewReader(store.file)
+	var valid int64
+	for {
+		op, payload, size, err := ReadRecord(reader)
+		if err == io.EOF || err == ErrTornRecord {
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case record_put:
+			var node Node
+			if node, err = DecodeNode(payload); err == nil {
+				store.cache.Put(HashOf(payload), node)
+			}
+		case record_delete:
+			store.cache.Delete(hex.EncodeToString(payload))
+		default:
+			err = errors.New("unknown_record")
+		}
+		if err != nil {
+			// the last record may be garbage left by a crash, one before it is not
+			if _, more := reader.Peek(1); more == io.EOF {
+				return valid, nil
+			}
+			return 0, errors.New("corrupt record at offset " + strconv.FormatInt(valid, 10) + ": " + err.Error())
+		}
+		valid += size
+	}
+}
+
+func (store *FileStore) Get(hash string) (Node, bool) {
+	return store.cache.Get(hash)
+}
+
+func (store *FileStore) Put(hash string, node Node) error {
+	if _, ok := store.cache.Get(hash); ok {
+		// nothing to write, but the node counts as put again
+		return store.cache.Put(hash, node)
+	}
+	if err := store.append(record_put, node.Encode()); err != nil {
+		return err
+	}
+	return store.cache.Put(hash, node)
+}
+
+func (store *FileStore) Delete(hash string) error {
+	if _, ok := store.cache.Get(hash); !ok {
+		return nil
+	}
+	if err := store.append(record_delete, hash_bytes(hash)); err != nil {
+		return err
+	}
+	return store.cache.Delete(hash)
+}
+
+func (store *FileStore) Len() int {
+	return store.cache.Len()
+}
+
+func (store *FileStore) Range(fn func(hash string, node Node)) {
+	store.cache.Range(fn)
+}
+
+func (store *FileStore) Generation() uint64 {
+	return store.cache.Generation()
+}
+
+func (store *FileStore) LastPut(hash string) uint64 {
+	return store.cache.LastPut(hash)
+}
+
+func (store *FileStore) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.file.Close()
+}
+
+func (store *FileStore) append(op byte, payload []byte) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return WriteRecord(store.file, op, payload)
+}
+
+// Logs of records, used by FileStore and by the block log of p2: a record is one op byte,
+// the uvarint length of its payload and the payload.
+
+// ErrTornRecord is a record cut short by a crash, or whose length is corrupt
+var ErrTornRecord = errors.New("torn_record")
+
+// WriteRecord writes a record with a single Write, so a crash leaves at most one torn record
+func WriteRecord(w io.Writer, op byte, payload []byte) error {
+	if len(payload) > MAX_RECORD_SIZE {
+		return errors.New("record_too_large")
+	}
+	record := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(payload))
+	record[0] = op
+	n := binary.PutUvarint(record[1:], uint64(len(payload)))
+	record = append(record[:1+n], payload...)
+	_, err := w.Write(record)
+	return err
+}
+
+// ReadRecord reads the next record and returns its size in the log. The error is io.EOF
+// at the end of the log and ErrTornRecord for a record the log ends in the middle of.
+func ReadRecord(reader *bufio.Reader) (byte, []byte, int64, error) {
+	op, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > MAX_RECORD_SIZE {
+		return 0, nil, 0, ErrTornRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, 0, ErrTornRecord
+	}
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return op, payload, 1 + int64(binary.PutUvarint(tmp, length)) + int64(length), nil
+}
+
+//=================================== open a stored trie ===================================
+// OpenTrie returns the trie whose root is root inside store.
+// An empty root opens an empty trie backed by store.
+func OpenTrie(store NodeStore, root string) (MerklePatriciaTrie, error) {
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	if root == "" {
+		return mpt, nil
+	}
+	if _, ok := store.Get(root); !ok {
+		return mpt, errors.New("root_not_found")
+	}
+	mpt.root = root
+	return mpt, nil
+}
@@ -0,0 +1,133 @@
+package p1
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileStoreReopen(t *testing.T) {
+	path := t.TempDir() + "/nodes.log"
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("a", "1")
+	mpt.Insert("b", "2")
+	root := mpt.root
+	store.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := OpenTrie(store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := reopened.Get("b"); err != nil || value != "2" {
+		t.Fatalf("get b = %q, %v", value, err)
+	}
+}
+
+// a record whose length is garbage ends the log, the records before it are kept
+func TestFileStoreCorruptLength(t *testing.T) {
+	path := t.TempDir() + "/nodes.log"
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("a", "1")
+	root := mpt.root
+	store.Close()
+	info, _ := os.Stat(path)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{record_put, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 'x'})
+	file.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := OpenTrie(store, root); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Fatalf("log is %d bytes, want the %d valid ones", after.Size(), info.Size())
+	}
+}
+
+// a record in the middle of the log that cannot be decoded is reported, not cut off with
+// everything after it
+func TestFileStoreCorruptRecord(t *testing.T) {
+	path := t.TempDir() + "/nodes.log"
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("a", "1")
+	mpt.Insert("b", "2")
+	store.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'X'
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if store, err := NewFileStore(path); err == nil {
+		store.Close()
+		t.Fatal("opened a log corrupt in the middle")
+	}
+	if after, _ := os.Stat(path); after.Size() != int64(len(data)) {
+		t.Fatalf("log was cut to %d bytes", after.Size())
+	}
+}
+
+// a last record that is complete but garbage is left by a crash and cut off
+func TestFileStoreCorruptLastRecord(t *testing.T) {
+	path := t.TempDir() + "/nodes.log"
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("a", "1")
+	root := mpt.root
+	store.Close()
+	info, _ := os.Stat(path)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{record_put, 2, 0, 0})
+	file.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := OpenTrie(store, root); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Fatalf("log is %d bytes, want the %d valid ones", after.Size(), info.Size())
+	}
+}
@@ -0,0 +1,67 @@
+package p1
+
+import "errors"
+
+// NodeFetcher asks someone else for the encoding of the node with the given hash
+type NodeFetcher func(hash string) ([]byte, error)
+
+// SyncTrie copies the trie below root into store node by node, starting from the root.
+// Nodes already in store are not fetched again, and neither is anything below them: the
+// tries of a store are always written children first, so a stored node has its subtree.
+// Every fetched node must hash to the hash it was asked for. Nothing is written to store
+// on failure. On success the nodes that were already there are put again, so a Pruner
+// counts them as recent and keeps them with their subtree until the trie is retained.
+func SyncTrie(store NodeStore, root string, fetch NodeFetcher) (MerklePatriciaTrie, error) {
+	if root == "" {
+		return OpenTrie(store, "")
+	}
+	reused := map[string]Node{}
+	nodes := map[string]Node{}
+	queue := []string{root}
+	for len(queue) != 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := nodes[hash]; ok {
+			continue
+		}
+		if node, ok := store.Get(hash); ok {
+			reused[hash] = node
+			continue
+		}
+		data, err := fetch(hash)
+		if err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+		if HashOf(data) != hash {
+			return MerklePatriciaTrie{}, errors.New("node_hash_mismatch")
+		}
+		node, err := DecodeNode(data)
+		if err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+		nodes[hash] = node
+		queue = append(queue, children(node)...)
+	}
+	for _, hash := range children_first(root, nodes) {
+		if err := store.Put(hash, nodes[hash]); err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+	}
+	for hash, node := range reused {
+		if err := store.Put(hash, node); err != nil {
+			return MerklePatriciaTrie{}, err
+		}
+	}
+	return OpenTrie(store, root)
+}
+
+// StoreFetcher serves the nodes of store, e.g. to sync from a local copy
+func StoreFetcher(store NodeStore) NodeFetcher {
+	return func(hash string) ([]byte, error) {
+		node, ok := store.Get(hash)
+		if !ok {
+			return nil, errors.New("missing_node")
+		}
+		return node.Encode(), nil
+	}
+}
@@ -0,0 +1,78 @@
+package p1
+
+import (
+	"errors"
+	"testing"
+)
+
+func sync_source() MerklePatriciaTrie {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, key := range []string{"content", "react", "reaction", "hint/1", "hint/2"} {
+		mpt.Insert(key, "v"+key)
+	}
+	return mpt
+}
+
+func TestSyncTrie(t *testing.T) {
+	source := sync_source()
+	store := NewMemoryStore()
+	fetches := 0
+	fetch := func(hash string) ([]byte, error) {
+		fetches++
+		return StoreFetcher(source.db)(hash)
+	}
+	mpt, err := SyncTrie(store, source.root, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != store.Len() {
+		t.Errorf("%d fetches for %d nodes", fetches, store.Len())
+	}
+	if value, err := mpt.Get("hint/2"); err != nil || value != "vhint/2" {
+		t.Fatalf("get hint/2 = %q, %v", value, err)
+	}
+	fetches = 0
+	if _, err := SyncTrie(store, source.root, fetch); err != nil || fetches != 0 {
+		t.Fatalf("second sync fetched %d nodes, %v", fetches, err)
+	}
+}
+
+// a peer answering with another node than the one asked for is caught by its hash
+func TestSyncTrieRejectsWrongNode(t *testing.T) {
+	source := sync_source()
+	other := MerklePatriciaTrie{}
+	other.Initial()
+	other.Insert("content", "forged")
+	forged, _ := other.db.Get(other.root)
+	fetch := func(hash string) ([]byte, error) {
+		if hash != source.root {
+			return forged.Encode(), nil
+		}
+		return StoreFetcher(source.db)(hash)
+	}
+	store := NewMemoryStore()
+	if _, err := SyncTrie(store, source.root, fetch); err == nil || err.Error() != "node_hash_mismatch" {
+		t.Fatalf("sync with a forged node: %v", err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("%d nodes written by a failed sync", store.Len())
+	}
+}
+
+func TestSyncTrieFailsOnMissingNode(t *testing.T) {
+	source := sync_source()
+	fetch := func(hash string) ([]byte, error) {
+		if hash != source.root {
+			return nil, errors.New("not_found")
+		}
+		return StoreFetcher(source.db)(hash)
+	}
+	store := NewMemoryStore()
+	if _, err := SyncTrie(store, source.root, fetch); err == nil {
+		t.Fatal("sync succeeded without the nodes below the root")
+	}
+	if store.Len() != 0 {
+		t.Errorf("%d nodes written by a failed sync", store.Len())
+	}
+}
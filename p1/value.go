@@ -0,0 +1,72 @@
+package p1
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ValueCodec turns typed values into the strings the trie stores and back. Encode must be
+// deterministic, the same value always gives the same string, because the string is hashed
+// into the nodes and two peers storing the same value must reach the same root.
+type ValueCodec interface {
+	Encode(v interface{}) (string, error)
+	Decode(data string, v interface{}) error
+}
+
+// JsonCodec encodes with encoding/json: struct fields in declaration order, map keys sorted
+type JsonCodec struct{}
+
+func (JsonCodec) Encode(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (JsonCodec) Decode(data string, v interface{}) error {
+	return json.Unmarshal([]byte(data), v)
+}
+
+// DefaultCodec is used by PutValue and GetValue, every peer must use the same one
+var DefaultCodec ValueCodec = JsonCodec{}
+
+func encode_value(v interface{}) (string, error) {
+	value, err := DefaultCodec.Encode(v)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		// an empty string is how the trie says there is no value
+		return "", errors.New("empty_value")
+	}
+	return value, nil
+}
+
+// PutValue stores v under key with DefaultCodec and returns the new root
+func (mpt *MerklePatriciaTrie) PutValue(key string, v interface{}) (string, error) {
+	value, err := encode_value(v)
+	if err != nil {
+		return mpt.root, err
+	}
+	return mpt.Insert(key, value), nil
+}
+
+// GetValue decodes the value of key into v, which must be a pointer
+func (mpt *MerklePatriciaTrie) GetValue(key string, v interface{}) error {
+	value, err := mpt.Get(key)
+	if err != nil {
+		return err
+	}
+	return DefaultCodec.Decode(value, v)
+}
+
+// PutValue is Put with a typed value, see MerklePatriciaTrie.PutValue
+func (batch *Batch) PutValue(key string, v interface{}) error {
+	value, err := encode_value(v)
+	if err != nil {
+		return err
+	}
+	batch.Put(key, value)
+	return nil
+}
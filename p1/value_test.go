@@ -0,0 +1,76 @@
+package p1
+
+import (
+	"reflect"
+	"testing"
+)
+
+type test_move struct {
+	Player string
+	Choice string
+	Scores map[string]int
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	move := test_move{Player: "1", Choice: "A", Scores: map[string]int{"b": 2, "a": 1}}
+	if _, err := mpt.PutValue("move/1", move); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mpt.PutValue("count", 3); err != nil {
+		t.Fatal(err)
+	}
+	got := test_move{}
+	if err := mpt.GetValue("move/1", &got); err != nil || !reflect.DeepEqual(got, move) {
+		t.Fatalf("get move/1 = %+v, %v", got, err)
+	}
+	count := 0
+	if err := mpt.GetValue("count", &count); err != nil || count != 3 {
+		t.Fatalf("get count = %d, %v", count, err)
+	}
+	if err := mpt.GetValue("missing", &count); err == nil {
+		t.Fatal("got a value for a missing key")
+	}
+	if err := mpt.GetValue("move/1", &count); err == nil {
+		t.Fatal("decoded a move into an int")
+	}
+}
+
+// the same value stored the same way on two peers gives the same root
+func TestValueEncodingIsDeterministic(t *testing.T) {
+	roots := []string{}
+	for i := 0; i < 10; i++ {
+		mpt := MerklePatriciaTrie{}
+		mpt.Initial()
+		scores := map[string]int{}
+		for j, id := range []string{"d", "a", "c", "b", "e"} {
+			scores[id] = j
+		}
+		mpt.PutValue("move", test_move{Player: "1", Scores: scores})
+		batch := mpt.NewBatch()
+		if err := batch.PutValue("hint", map[string]bool{"y": true, "x": false}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, mpt.Get_root())
+	}
+	for _, root := range roots {
+		if root != roots[0] {
+			t.Fatalf("roots differ: %v", roots)
+		}
+	}
+}
+
+func TestValueRejectsUnencodable(t *testing.T) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	if _, err := mpt.PutValue("f", func() {}); err == nil {
+		t.Error("stored a func")
+	}
+	if mpt.Get_root() != "" {
+		t.Error("a failed put changed the root")
+	}
+}
@@ -3,10 +3,12 @@ package p2
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"../p1"
 	"golang.org/x/crypto/sha3"
@@ -42,15 +44,19 @@ type Header struct {
 	//The value must be in the UNIX timestamp format such as 1550013938
 	TimeStamp int64
 
-	// Block’s hash is the SHA3-256 encoded value of this string(note that you have to follow this specific order):
-	// hash_str := string(b.Header.Height)
-	// + string(b.Header.Timestamp) + b.Header.ParentHash + b.Value.Root + string(b.Header.Size)
+	// Block’s hash is the SHA3-256 of the canonical encoding of the header, see Header.Encode
 	Hash string
 
 	ParentHash string
 	// The size is the length of the byte array of the block value
 	Size int32
 
+	// root hash of the block's MPT
+	Root string
+
+	// encoding the hash was computed with
+	Version uint8
+
 	// newly added
 	// 	Find x such that y starts with at least 10 0's, while y is defined as
 	// y = SHA-3(Hash of the parent block || x || root hash of MPT of the current block content)
@@ -58,10 +64,6 @@ type Header struct {
 	rank map[string]int32
 
 	creator string
-
-	playerList string
-
-	minorList map[string]string
 }
 
 // Each block must have a value, which is a Merkle Patricia Trie.
@@ -70,19 +72,38 @@ type Header struct {
 type Block struct {
 	Header Header
 	Value  p1.MerklePatriciaTrie
+
+	// players join and creators get their secret after the block is made, so these are
+	// kept out of the header and its hash
+	playerList string
+
+	minorList map[string]string
 }
 
+// TrieStore holds the MPT nodes of every block, so blocks with the same content share nodes
+// instead of each keeping a private copy. Swap it for a p1.FileStore to keep tries on disk.
+var TrieStore p1.NodeStore = p1.NewMemoryStore()
+
+// FetchNode gets the MPT nodes a block refers to but TrieStore does not have yet,
+// nil means blocks can only be decoded when their trie is already here
+var FetchNode p1.NodeFetcher
+
+// BlockJson is the wire form of a block, see wire.go
 type BlockJson struct {
+	Format     int               `json:"format,omitempty"`
 	Height     int32             `json:"height"`
 	Timestamp  int64             `json:"timeStamp"`
 	Hash       string            `json:"hash"`
 	ParentHash string            `json:"parentHash"`
 	Creator    string            `json:"creator"`
 	Size       int32             `json:"size"`
-	MPT        map[string]string `json:"mpt"`
+	Version    uint8             `json:"version"`
+	Root       string            `json:"root"`
+	MPT        map[string]string `json:"mpt,omitempty"`
+	Nodes      *p1.TrieJson      `json:"nodes,omitempty"`
 	Rank       map[string]int32  `json:"rank"`
-	playerList string            `json:"playerlist"`
-	minorList  map[string]string `json:"minorlist"`
+	PlayerList string            `json:"playerlist"`
+	MinorList  map[string]string `json:"minorlist"`
 }
 
 func calculateSize(mpt *p1.MerklePatriciaTrie) int32 {
@@ -100,13 +121,13 @@ func NewBlock(height int32, timeStamp int64, parentHash string, mpt p1.MerklePat
 func (b *Block) Initial(height int32, timeStamp int64, parentHash string, mpt p1.MerklePatriciaTrie, rank map[string]int32, creator string, playerlist string, minorlist map[string]string) {
 	//create header
 	size := calculateSize(&mpt)
-	hash_str := string(height) + string(timeStamp) + parentHash + mpt.Get_root() + string(size)
-	sum := sha3.Sum256([]byte(hash_str))
-	hash := hex.EncodeToString(sum[:])
 
 	//assign to block
-	b.Header = Header{Height: height, TimeStamp: timeStamp, Hash: hash, ParentHash: parentHash, Size: size, rank: rank, creator: creator, playerList: playerlist, minorList: minorlist}
+	b.Header = Header{Height: height, TimeStamp: timeStamp, ParentHash: parentHash, Size: size, Root: mpt.Get_root(), Version: HEADER_VERSION, rank: rank, creator: creator}
+	b.Header.Hash, _ = b.Header.ComputeHash()
 	b.Value = mpt
+	b.playerList = playerlist
+	b.minorList = minorlist
 }
 
 // takes a string that represents the JSON value of a block as an input, and decodes the input string back to a block instance.
@@ -121,18 +142,13 @@ func DecodeFromJson(jsonString string) *Block {
 	if err != nil {
 		fmt.Println("some error deeper in bc")
 		return nil
-	} else {
-		header := Header{Height: result.Height, TimeStamp: result.Timestamp, Hash: result.Hash, ParentHash: result.ParentHash, Size: result.Size, rank: result.Rank, creator: result.Creator, playerList: result.playerList, minorList: result.minorList}
-
-		mpt := p1.MerklePatriciaTrie{}
-		mpt.Initial()
-		for key, value := range result.MPT {
-			mpt.Insert(key, value)
-		}
-		b := Block{Header: header, Value: mpt}
-		fmt.Println(header.ParentHash)
-		return &b
 	}
+	b, err := result.ToBlock()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return b
 }
 
 // Description: This function encodes a block instance into a JSON format string.
@@ -155,24 +171,21 @@ func DecodeFromJson(jsonString string) *Block {
 //         "hello":"world"
 //     }
 // }
+//
+// The MPT is no longer sent as its (key, value) pairs, only its root is. The receiver
+// fetches the nodes it is missing by hash from /node/{hash}, see FetchNode.
+// The header is sent whole, see Block.ToJson.
 
 func (b *Block) EncodeToJson() string {
-	str := "{"
-	str += `"hash": "` + b.Header.Hash + `", `
-	str += `"timeStamp": ` + fmt.Sprint(b.Header.TimeStamp) + `, `
-	str += `"height": ` + fmt.Sprint(b.Header.Height) + `, `
-	str += `"parentHash": "` + b.Header.ParentHash + `", `
-	str += `"size": ` + fmt.Sprint(b.Header.Size) + `, `
-	str += `"mpt": ` + b.Value.GetJsonString() + `, `
-	str += `"creator": "` + b.Header.creator + `", `
-	str += `"playerlist": "` + b.Header.playerList + `", `
-	str += `"minorlist": ` + b.GetMinorString() + `, `
-	str += `"rank": ` + b.GetRankString() + `}`
-	return str
+	str, err := json.Marshal(b.ToJson())
+	if err != nil {
+		return "{}"
+	}
+	return string(str)
 }
 
 func (b *Block) GetMinorString() string {
-	minorlist, err := json.Marshal(b.Header.minorList)
+	minorlist, err := json.Marshal(b.minorList)
 	if err != nil {
 		return "{}"
 	}
@@ -202,6 +215,16 @@ func (b *Block) GetRankString() string {
 type BlockChain struct {
 	Chain  map[int32][]Block
 	Length int32 //最高height的
+
+	// hash index and children lists, see index.go
+	byHash   map[string]blockRef
+	children map[string][]string
+
+	// fork choice, see forkchoice.go
+	head           string
+	canonical      map[string]bool
+	rule           ForkRule
+	reorgListeners []func(event ReorgEvent)
 }
 
 func NewBlockChain() *BlockChain {
@@ -232,12 +255,11 @@ func (bc *BlockChain) Get(height int32) []Block {
 // Argument: block
 func (bc *BlockChain) Insert(b *Block) {
 	height := b.Header.Height
-	blocks := bc.Chain[height]
-	for i := 0; i < len(blocks); i++ {
-		if b.Header.Hash == blocks[i].Header.Hash {
-			return
-		}
+	if bc.HasBlock(b.Header.Hash) {
+		return
 	}
+	bc.byHash[b.Header.Hash] = blockRef{height: height, position: len(bc.Chain[height])}
+	bc.children[b.Header.ParentHash] = append(bc.children[b.Header.ParentHash], b.Header.Hash)
 	if bc.Chain[height] == nil {
 		bc.Chain[height] = []Block{*b}
 	} else {
@@ -248,6 +270,7 @@ func (bc *BlockChain) Insert(b *Block) {
 		bc.Length = height
 		fmt.Println("hahaha change the height")
 	}
+	bc.blockInserted(b)
 }
 
 // Description: This function iterates over all the blocks, generate blocks'
@@ -286,16 +309,15 @@ func (bc *BlockChain) Insert(b *Block) {
 // }
 
 func (bc *BlockChain) EncodeToJson() (string, error) {
-	ret := "["
-	chain := bc.Chain
-	for _, v := range chain {
-		for i := 0; i < len(v); i++ {
-			ret += v[i].EncodeToJson() + ","
-		}
+	blocks := []BlockJson{}
+	for _, block := range bc.blocksInOrder() {
+		blocks = append(blocks, block.ToJson())
 	}
-	ret = ret[:len(ret)-1]
-	ret += "]"
-	return ret, nil
+	ret, err := json.Marshal(blocks)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
 }
 
 // Description: This function is called upon a blockchain instance.
@@ -336,25 +358,42 @@ func (bc *BlockChain) DecodeFromJson(jsonString string) error {
 	}
 
 	if bc.Chain == nil {
-		bc = NewBlockChain()
+		bc.Chain = make(map[int32][]Block)
+		bc.byHash = nil
 	}
 
 	for i := 0; i < len(result); i++ {
-		jsonObj, err := json.Marshal(result[i])
+		block, err := result[i].ToBlock()
 		if err != nil {
-			return err
+			return errors.New("block " + result[i].Hash + " cannot be decoded: " + err.Error())
+		}
+		if err := block.Verify(); err != nil {
+			return errors.New("block " + result[i].Hash + " cannot be verified: " + err.Error())
 		}
-		bc.Insert(DecodeFromJson(string(jsonObj)))
+		bc.Insert(block)
 	}
 	return nil
 }
 
 func DecodeJsonToBlockChain(jsonString string) (*BlockChain, error) {
 	bc := NewBlockChain()
-	bc.DecodeFromJson(jsonString)
+	if err := bc.DecodeFromJson(jsonString); err != nil {
+		return nil, err
+	}
 	return bc, nil
 }
 
+// Roots returns the MPT root of every block, the tries to keep when pruning TrieStore
+func (bc *BlockChain) Roots() []string {
+	roots := []string{}
+	for _, blocks := range bc.Chain {
+		for _, block := range blocks {
+			roots = append(roots, block.Value.Get_root())
+		}
+	}
+	return roots
+}
+
 // This function returns the list of blocks of height "BlockChain.length".
 func (bc *BlockChain) GetLatestBlocks() []Block {
 	return bc.Chain[bc.Length]
@@ -366,11 +405,10 @@ func (bc *BlockChain) GetParentBlock(block Block) Block {
 	if curHeight <= 1 {
 		return Block{Header: Header{}}
 	}
-	for _, parentBlock := range bc.Chain[curHeight-1] {
-		if parentBlock.Header.Hash == block.Header.ParentHash {
-			fmt.Println("FOUND PARENTBLOCK!!! ", parentBlock.Header.Hash, ": ", parentBlock.Header.Height)
-			return parentBlock
-		}
+	parentBlock, found := bc.GetBlockByHash(block.Header.ParentHash)
+	if found && parentBlock.Header.Height == curHeight-1 {
+		fmt.Println("FOUND PARENTBLOCK!!! ", parentBlock.Header.Hash, ": ", parentBlock.Header.Height)
+		return parentBlock
 	}
 	return Block{Header: Header{}}
 }
@@ -383,67 +421,64 @@ func (bc *BlockChain) GetBlocks(height int32) []Block {
 }
 
 func (bc *BlockChain) AddCreator(id string, secret string, height int32, hash string) {
-	for k, v := range bc.Chain[height] {
-		if v.Header.Hash == hash {
-			bc.Chain[height][k].Header.minorList[id] = secret
-			fmt.Println("Creator Added")
-			fmt.Println(bc.Chain[height][k].Header.minorList)
-		}
+	if block := bc.getBlockRef(height, hash); block != nil {
+		block.minorList[id] = secret
+		fmt.Println("Creator Added")
+		fmt.Println(block.minorList)
 	}
 }
 
 func (bc *BlockChain) AddPlayer(id string, height int32, hash string) {
-	for k, v := range bc.Chain[height] {
-		if v.Header.Hash == hash {
-			bc.Chain[height][k].Header.playerList += id + " "
-			fmt.Println("hahaha " + bc.Chain[height][k].Header.playerList)
-		}
+	if block := bc.getBlockRef(height, hash); block != nil {
+		block.playerList += id + " "
+		fmt.Println("hahaha " + block.playerList)
 	}
+	bc.playersChanged(hash)
 }
 
 func (b *Block) VerifySecret(id string, secret string) bool {
-	fmt.Println("Verifying: " + b.Header.minorList[id])
-	if b.Header.minorList[id] == secret {
+	fmt.Println("Verifying: " + b.minorList[id])
+	if b.minorList[id] == secret {
 		return true
 	}
 	return false
 }
 
 func (b *Block) GetPlayer() []string {
-	fmt.Println("list: " + b.Header.playerList)
-	return strings.Fields(b.Header.playerList)
+	fmt.Println("list: " + b.playerList)
+	return strings.Fields(b.playerList)
 }
 
 func (b *Block) GetMinor() map[string]string {
-	return b.Header.minorList
+	return b.minorList
 }
 
 func (bc *BlockChain) UpdateBlock(block Block, creator string) bool {
-	for _, v := range bc.Chain[block.Header.Height] {
-		if v.Header.Hash == block.Header.Hash && v.Header.creator == creator {
-			//update player
-			currentPlayer := v.GetPlayer()
-			updatePlayer := block.GetPlayer()
-			for _, playerId := range updatePlayer {
-				found := false
-				for _, currentId := range currentPlayer {
-					if currentId == playerId {
-						found = true
-					}
-				}
-				if !found {
-					v.Header.playerList += " " + playerId
-				}
-			}
-			//update minor
-			updateMinor := block.GetMinor()
-			for id, secret := range updateMinor {
-				v.Header.minorList[id] = secret
+	v := bc.getBlockRef(block.Header.Height, block.Header.Hash)
+	if v == nil || v.Header.creator != creator {
+		return false
+	}
+	//update player
+	currentPlayer := v.GetPlayer()
+	updatePlayer := block.GetPlayer()
+	for _, playerId := range updatePlayer {
+		found := false
+		for _, currentId := range currentPlayer {
+			if currentId == playerId {
+				found = true
 			}
-			return true
+		}
+		if !found {
+			v.playerList += " " + playerId
 		}
 	}
-	return false
+	//update minor
+	updateMinor := block.GetMinor()
+	for id, secret := range updateMinor {
+		v.minorList[id] = secret
+	}
+	bc.playersChanged(v.Header.Hash)
+	return true
 }
 
 // type BlockChain struct {
@@ -458,12 +493,12 @@ func (bc *BlockChain) GetOverview(id string) string {
 		fmt.Println(i)
 		res += "LEVEL " + strconv.Itoa(int(i)) + ": \n"
 		for j := 0; j < len(blocks); j++ {
-			if blocks[j].Header.minorList[id] != "" {
+			if blocks[j].minorList[id] != "" {
 				passed = "Yes"
 			} else {
 				passed = "No"
 			}
-			res += "Block " + string(j) + blocks[j].Header.Hash + "; Parent: " + blocks[j].Header.ParentHash + "; Passed: " + passed + "\n"
+			res += "Block " + strconv.Itoa(j) + " " + blocks[j].Header.Hash + "; Parent: " + blocks[j].Header.ParentHash + "; Created: " + blocks[j].CreatedAt().Format(time.RFC3339) + "; Passed: " + passed + "\n"
 		}
 		res += "======================================================================================================================================================\n"
 	}
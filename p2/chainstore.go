@@ -0,0 +1,159 @@
+package p2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"../p1"
+)
+
+// ChainStore is an append-only log of the blocks of a BlockChain, made of the same records
+// as p1.FileStore, see p1.WriteRecord. 'B' holds a new block as JSON
+// with the nodes of its MPT, 'U' holds a block again after its players or secrets changed,
+// without the nodes. Replaying the log gives back the chain, the last record of a hash wins.
+// When the whole chain is replaced the log is rewritten, see Replace.
+type ChainStore struct {
+	path string
+	file *os.File
+	mux  sync.Mutex
+}
+
+const (
+	record_block  = 'B'
+	record_update = 'U'
+)
+
+// OpenChainStore opens (or creates) the log at path and replays it into a new BlockChain,
+// the tries go to TrieStore. The hash index and the canonical head are rebuilt from the
+// blocks. A half written record at the end, left by a crash, is cut off; a record that
+// cannot be decoded or whose hash does not verify is skipped.
+func OpenChainStore(path string) (*ChainStore, *BlockChain, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := &ChainStore{path: path, file: file}
+	bc := NewBlockChain()
+	valid, err := store.replay(bc)
+	bc.updateHead()
+	if err == nil {
+		err = file.Truncate(valid)
+	}
+	if err == nil {
+		_, err = file.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return store, bc, nil
+}
+
+func (store *ChainStore) replay(bc *BlockChain) (int64, error) {
+	reader := bufio.NewReader(store.file)
+	var valid int64
+	for {
+		op, payload, size, err := p1.ReadRecord(reader)
+		if err == io.EOF || err == p1.ErrTornRecord {
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if op != record_block && op != record_update {
+			return valid, nil
+		}
+		valid += size
+
+		block := DecodeFromJson(string(payload))
+		if block == nil || block.Verify() != nil {
+			fmt.Println("chain store: skipping a block that cannot be verified")
+			continue
+		}
+		if stored := bc.getBlockRef(block.Header.Height, block.Header.Hash); stored != nil {
+			*stored = *block
+		} else {
+			bc.Insert(block)
+		}
+	}
+}
+
+// Append records a block that was just inserted
+func (store *ChainStore) Append(b *Block) error {
+	return store.write(record_block, b, true)
+}
+
+// Update records a block again after its players or secrets changed
+func (store *ChainStore) Update(b *Block) error {
+	return store.write(record_update, b, false)
+}
+
+// Replace rewrites the log with the blocks of bc only, after the whole chain was replaced,
+// so the dropped blocks do not come back on the next open and the log does not grow with
+// every download. The new log is written next to the old one and renamed over it, a crash
+// leaves one or the other.
+func (store *ChainStore) Replace(bc *BlockChain) error {
+	tmp := store.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, block := range bc.blocksInOrder() {
+		payload, err := encode_record(&block, true)
+		if err == nil {
+			err = p1.WriteRecord(writer, record_block, payload)
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, store.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	store.file.Close()
+	store.file = file
+	return nil
+}
+
+func (store *ChainStore) Close() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.file.Close()
+}
+
+func (store *ChainStore) write(op byte, b *Block, withNodes bool) error {
+	payload, err := encode_record(b, withNodes)
+	if err != nil {
+		return err
+	}
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return p1.WriteRecord(store.file, op, payload)
+}
+
+func encode_record(b *Block, withNodes bool) ([]byte, error) {
+	record := b.ToJson()
+	if withNodes {
+		nodes := b.Value.ExportNodes()
+		record.Nodes = &nodes
+	}
+	return json.Marshal(record)
+}
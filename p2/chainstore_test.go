@@ -0,0 +1,145 @@
+package p2
+
+import (
+	"os"
+	"testing"
+
+	"../p1"
+)
+
+func TestChainStoreReopen(t *testing.T) {
+	use_memory_store(t)
+	path := t.TempDir() + "/chain.log"
+	store, bc, err := OpenChainStore(path)
+	if err != nil || bc.Length != 0 {
+		t.Fatalf("new store has %d blocks: %v", bc.Length, err)
+	}
+	genesis := test_block(1, "genesis", "first")
+	child := test_block(2, genesis.Header.Hash, "second")
+	for _, b := range []*Block{genesis, child} {
+		bc.Insert(b)
+		if err := store.Append(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc.AddCreator("2", "secret", 1, genesis.Header.Hash)
+	bc.AddPlayer("2", 1, genesis.Header.Hash)
+	updated, _ := bc.GetBlockByHash(genesis.Header.Hash)
+	if err := store.Update(&updated); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// a crash in the middle of a record
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{record_block, 0xff, 0x01, '{'})
+	file.Close()
+
+	// the tries come back from the log, not from the old store
+	TrieStore = p1.NewMemoryStore()
+	store, bc, err = OpenChainStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if bc.Length != 2 {
+		t.Fatalf("%d blocks after reopening", bc.Length)
+	}
+	restored, _ := bc.GetBlockByHash(genesis.Header.Hash)
+	if !restored.VerifySecret("2", "secret") || len(restored.GetPlayer()) != 1 {
+		t.Fatal("the update of the genesis block was lost")
+	}
+	if value, err := restored.Value.Get("question"); err != nil || value != "first" {
+		t.Fatalf("question %q, %v", value, err)
+	}
+	if head, _ := bc.CanonicalHead(); head.Header.Hash != child.Header.Hash {
+		t.Fatalf("head %s, want %s", head.Header.Hash, child.Header.Hash)
+	}
+	if size, _ := os.Stat(path); size.Size() == 0 {
+		t.Fatal("the log was emptied")
+	}
+}
+
+func TestChainStoreCutsTornTail(t *testing.T) {
+	use_memory_store(t)
+	path := t.TempDir() + "/chain.log"
+	store, _, err := OpenChainStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Append(test_block(1, "genesis", "first"))
+	store.Close()
+	before, _ := os.Stat(path)
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{record_update, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+	file.Close()
+	store, bc, err := OpenChainStore(path)
+	if err != nil || bc.Length != 1 {
+		t.Fatalf("%d blocks: %v", bc.Length, err)
+	}
+	store.Close()
+	if after, _ := os.Stat(path); after.Size() != before.Size() {
+		t.Fatalf("log is %d bytes, want %d", after.Size(), before.Size())
+	}
+}
+
+// after a replace the log holds the new chain only, the dropped blocks stay dropped
+func TestChainStoreReplace(t *testing.T) {
+	use_memory_store(t)
+	path := t.TempDir() + "/chain.log"
+	store, bc, err := OpenChainStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := test_block(1, "genesis", "g")
+	a1 := grow(g, "a1")
+	a2 := grow(a1, "a2")
+	for _, b := range []*Block{g, a1, a2} {
+		bc.Insert(b)
+		store.Append(b)
+	}
+	other := NewBlockChain()
+	b1 := grow(g, "b1")
+	for _, b := range []*Block{g, b1} {
+		other.Insert(b)
+	}
+	other.AddPlayer("7", b1.Header.Height, b1.Header.Hash)
+	var sizes []int64
+	for i := 0; i < 3; i++ {
+		bc.Replace(other)
+		if err := store.Replace(bc); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		sizes = append(sizes, info.Size())
+	}
+	if sizes[0] != sizes[1] || sizes[1] != sizes[2] {
+		t.Fatalf("the log grows with every replace: %v", sizes)
+	}
+	// records appended after a replace go to the new log
+	b2 := grow(b1, "b2")
+	bc.Insert(b2)
+	if err := store.Append(b2); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	TrieStore = p1.NewMemoryStore()
+	store, bc, err = OpenChainStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	check_index(t, bc, []*Block{g, b1, b2}, []*Block{a1, a2})
+	check_head(t, bc, b2)
+	if block, _ := bc.GetBlockByHash(b1.Header.Hash); block.playerList != "7 " {
+		t.Fatalf("players of b1 %q", block.playerList)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary log left behind: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package p2
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time blocks are stamped and checked with
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock only moves when told to, for tests and replays
+type FakeClock struct {
+	now time.Time
+	mux sync.Mutex
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+	return clock.now
+}
+
+func (clock *FakeClock) Set(now time.Time) {
+	clock.mux.Lock()
+	clock.now = now
+	clock.mux.Unlock()
+}
+
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mux.Lock()
+	clock.now = clock.now.Add(d)
+	clock.mux.Unlock()
+}
+
+// BlockClock is the clock new blocks get their timestamp from
+var BlockClock Clock = SystemClock{}
+
+// NextTimeStamp is the timestamp for a new block after parent, never before the parent's
+// even when the parent's creator has a clock ahead of ours
+func NextTimeStamp(parent Block) int64 {
+	now := BlockClock.Now().Unix()
+	if now < parent.Header.TimeStamp {
+		return parent.Header.TimeStamp
+	}
+	return now
+}
+
+// CreatedAt is the time the block was made, from its timestamp
+func (b *Block) CreatedAt() time.Time {
+	return time.Unix(b.Header.TimeStamp, 0)
+}
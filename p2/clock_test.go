@@ -0,0 +1,50 @@
+package p2
+
+import (
+	"testing"
+	"time"
+)
+
+// use_fake_clock stamps and checks blocks with a clock the test moves
+func use_fake_clock(t *testing.T, now time.Time) *FakeClock {
+	old := BlockClock
+	clock := NewFakeClock(now)
+	BlockClock = clock
+	t.Cleanup(func() { BlockClock = old })
+	return clock
+}
+
+func TestNextTimeStamp(t *testing.T) {
+	clock := use_fake_clock(t, time.Unix(1550013950, 0))
+	parent := Block{Header: Header{TimeStamp: 1550013940}}
+	if ts := NextTimeStamp(parent); ts != 1550013950 {
+		t.Errorf("timestamp %d, want the clock's", ts)
+	}
+	clock.Advance(5 * time.Second)
+	if ts := NextTimeStamp(parent); ts != 1550013955 {
+		t.Errorf("timestamp %d after advancing the clock", ts)
+	}
+	// the parent's creator had a clock ahead of ours
+	clock.Set(time.Unix(1550013900, 0))
+	if ts := NextTimeStamp(parent); ts != parent.Header.TimeStamp {
+		t.Errorf("timestamp %d before the parent's %d", ts, parent.Header.TimeStamp)
+	}
+}
+
+func TestValidateRejectsFutureTimestamp(t *testing.T) {
+	use_memory_store(t)
+	clock := use_fake_clock(t, time.Unix(1550013937, 0))
+	genesis := test_block(1, "genesis", "first")
+	bc := NewBlockChain()
+	bc.Insert(genesis)
+	b := child(genesis, 2, 1550013937+MAX_CLOCK_DRIFT+1, map[string]int32{"1": 2, "2": 0}, "1")
+
+	err := bc.Validate(b)
+	if blockErr, ok := err.(*BlockError); !ok || blockErr.Reason != RejectBadTimestamp {
+		t.Fatalf("block %d seconds ahead: %v", MAX_CLOCK_DRIFT+1, err)
+	}
+	clock.Advance(time.Second)
+	if err := bc.Validate(b); err != nil {
+		t.Fatalf("block %d seconds ahead: %v", MAX_CLOCK_DRIFT, err)
+	}
+}
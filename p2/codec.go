@@ -0,0 +1,347 @@
+package p2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+
+	"../p1"
+)
+
+// Content types of blocks and block streams over HTTP. A peer asks for the binary one in
+// its Accept header and reads the Content-Type of the reply, old peers get JSON.
+const (
+	JSON_CONTENT_TYPE   = "application/json"
+	BINARY_CONTENT_TYPE = "application/x-block"
+)
+
+// Binary block encoding, the fields of BlockJson in the protobuf wire format: each field
+// is a uvarint tag, field number << 3 | wire type, then a uvarint for wire type 0 or a
+// uvarint length and the bytes for wire type 2. Unknown fields are skipped, so fields can
+// be added later. Rank and minorList entries, the MPT pairs and the nodes are nested
+// messages, the map entries sorted by key so a block always encodes the same way.
+// A stream of blocks is each block's encoding prefixed by its uvarint length.
+const (
+	wire_varint = 0
+	wire_bytes  = 2
+)
+
+const (
+	field_format     = 1
+	field_height     = 2
+	field_timestamp  = 3
+	field_hash       = 4
+	field_parent     = 5
+	field_size       = 6
+	field_version    = 7
+	field_root       = 8
+	field_creator    = 9
+	field_playerlist = 10
+	field_rank       = 11 // 1 id, 2 rank
+	field_minorlist  = 12 // 1 id, 2 secret
+	field_mpt        = 13 // 1 key, 2 value
+	field_nodes      = 14 // 1 root, 2 node, repeated
+)
+
+func (result *BlockJson) MarshalBinary() ([]byte, error) {
+	buf := bytes.Buffer{}
+	put_varint(&buf, field_format, uint64(result.Format))
+	put_varint(&buf, field_height, uint64(uint32(result.Height)))
+	put_varint(&buf, field_timestamp, uint64(result.Timestamp))
+	put_bytes(&buf, field_hash, []byte(result.Hash))
+	put_bytes(&buf, field_parent, []byte(result.ParentHash))
+	put_varint(&buf, field_size, uint64(uint32(result.Size)))
+	put_varint(&buf, field_version, uint64(result.Version))
+	put_bytes(&buf, field_root, []byte(result.Root))
+	put_bytes(&buf, field_creator, []byte(result.Creator))
+	put_bytes(&buf, field_playerlist, []byte(result.PlayerList))
+	ids := []string{}
+	for id := range result.Rank {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		entry := bytes.Buffer{}
+		put_bytes(&entry, 1, []byte(id))
+		put_varint(&entry, 2, uint64(uint32(result.Rank[id])))
+		put_bytes(&buf, field_rank, entry.Bytes())
+	}
+	put_pairs(&buf, field_minorlist, result.MinorList)
+	put_pairs(&buf, field_mpt, result.MPT)
+	if result.Nodes != nil {
+		entry := bytes.Buffer{}
+		put_bytes(&entry, 1, []byte(result.Nodes.Root))
+		for _, node := range result.Nodes.Nodes {
+			raw, err := hex.DecodeString(node)
+			if err != nil {
+				return nil, err
+			}
+			put_bytes(&entry, 2, raw)
+		}
+		put_bytes(&buf, field_nodes, entry.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+func (result *BlockJson) UnmarshalBinary(data []byte) error {
+	*result = BlockJson{}
+	return read_fields(data, func(field uint64, value uint64, payload []byte) error {
+		switch field {
+		case field_format:
+			result.Format = int(value)
+		case field_height:
+			result.Height = int32(uint32(value))
+		case field_timestamp:
+			result.Timestamp = int64(value)
+		case field_hash:
+			result.Hash = string(payload)
+		case field_parent:
+			result.ParentHash = string(payload)
+		case field_size:
+			result.Size = int32(uint32(value))
+		case field_version:
+			result.Version = uint8(value)
+		case field_root:
+			result.Root = string(payload)
+		case field_creator:
+			result.Creator = string(payload)
+		case field_playerlist:
+			result.PlayerList = string(payload)
+		case field_rank:
+			if result.Rank == nil {
+				result.Rank = map[string]int32{}
+			}
+			id, rank := "", int32(0)
+			err := read_fields(payload, func(field uint64, value uint64, payload []byte) error {
+				if field == 1 {
+					id = string(payload)
+				} else if field == 2 {
+					rank = int32(uint32(value))
+				}
+				return nil
+			})
+			result.Rank[id] = rank
+			return err
+		case field_minorlist:
+			if result.MinorList == nil {
+				result.MinorList = map[string]string{}
+			}
+			return read_pair(payload, result.MinorList)
+		case field_mpt:
+			if result.MPT == nil {
+				result.MPT = map[string]string{}
+			}
+			return read_pair(payload, result.MPT)
+		case field_nodes:
+			nodes := p1.TrieJson{Nodes: []string{}}
+			err := read_fields(payload, func(field uint64, value uint64, payload []byte) error {
+				if field == 1 {
+					nodes.Root = string(payload)
+				} else if field == 2 {
+					nodes.Nodes = append(nodes.Nodes, hex.EncodeToString(payload))
+				}
+				return nil
+			})
+			result.Nodes = &nodes
+			return err
+		}
+		return nil
+	})
+}
+
+// EncodeToBinary is the binary counterpart of EncodeToJson, the MPT is sent as its root
+func (b *Block) EncodeToBinary() []byte {
+	result := b.ToJson()
+	data, _ := result.MarshalBinary()
+	return data
+}
+
+// DecodeFromBinary is the binary counterpart of DecodeFromJson
+func DecodeFromBinary(data []byte) (*Block, error) {
+	var result BlockJson
+	if err := result.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return result.ToBlock()
+}
+
+// BlockWriter writes a stream of blocks
+type BlockWriter struct {
+	w io.Writer
+}
+
+func NewBlockWriter(w io.Writer) *BlockWriter {
+	return &BlockWriter{w: w}
+}
+
+func (writer *BlockWriter) Write(b *Block) error {
+	data := b.EncodeToBinary()
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	buf = append(buf[:binary.PutUvarint(buf, uint64(len(data)))], data...)
+	_, err := writer.w.Write(buf)
+	return err
+}
+
+// BlockReader reads a stream of blocks written by a BlockWriter
+type BlockReader struct {
+	r *bufio.Reader
+}
+
+func NewBlockReader(r io.Reader) *BlockReader {
+	return &BlockReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next block, io.EOF once the stream ended between two blocks
+func (reader *BlockReader) Read() (*Block, error) {
+	size, err := binary.ReadUvarint(reader.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > p1.MAX_RECORD_SIZE {
+		return nil, errors.New("block too large")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return DecodeFromBinary(data)
+}
+
+// EncodeToBinary writes every block of the chain as a block stream, lower heights first
+func (bc *BlockChain) EncodeToBinary() ([]byte, error) {
+	buf := bytes.Buffer{}
+	writer := NewBlockWriter(&buf)
+	for _, block := range bc.blocksInOrder() {
+		if err := writer.Write(&block); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeFromBinary inserts every block of a block stream, like DecodeFromJson
+func (bc *BlockChain) DecodeFromBinary(data []byte) error {
+	if bc.Chain == nil {
+		bc.Chain = make(map[int32][]Block)
+		bc.byHash = nil
+	}
+	reader := NewBlockReader(bytes.NewReader(data))
+	for {
+		block, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("block cannot be decoded: " + err.Error())
+		}
+		if err := block.Verify(); err != nil {
+			return errors.New("block " + block.Header.Hash + " cannot be verified: " + err.Error())
+		}
+		bc.Insert(block)
+	}
+}
+
+func DecodeBinaryToBlockChain(data []byte) (*BlockChain, error) {
+	bc := NewBlockChain()
+	if err := bc.DecodeFromBinary(data); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// blocksInOrder lists the blocks by height, then by hash
+func (bc *BlockChain) blocksInOrder() []Block {
+	heights := []int{}
+	for height := range bc.Chain {
+		heights = append(heights, int(height))
+	}
+	sort.Ints(heights)
+	ret := []Block{}
+	for _, height := range heights {
+		blocks := append([]Block{}, bc.Chain[int32(height)]...)
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].Header.Hash < blocks[j].Header.Hash })
+		ret = append(ret, blocks...)
+	}
+	return ret
+}
+
+func put_varint(buf *bytes.Buffer, field uint64, value uint64) {
+	write_uvarint(buf, field<<3|wire_varint)
+	write_uvarint(buf, value)
+}
+
+func put_bytes(buf *bytes.Buffer, field uint64, value []byte) {
+	write_uvarint(buf, field<<3|wire_bytes)
+	write_uvarint(buf, uint64(len(value)))
+	buf.Write(value)
+}
+
+func put_pairs(buf *bytes.Buffer, field uint64, pairs map[string]string) {
+	keys := []string{}
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := bytes.Buffer{}
+		put_bytes(&entry, 1, []byte(key))
+		put_bytes(&entry, 2, []byte(pairs[key]))
+		put_bytes(buf, field, entry.Bytes())
+	}
+}
+
+func read_pair(data []byte, pairs map[string]string) error {
+	key, value := "", ""
+	err := read_fields(data, func(field uint64, _ uint64, payload []byte) error {
+		if field == 1 {
+			key = string(payload)
+		} else if field == 2 {
+			value = string(payload)
+		}
+		return nil
+	})
+	pairs[key] = value
+	return err
+}
+
+// read_fields calls fn for every field of data, with the value of a varint field or the
+// payload of a bytes field
+func read_fields(data []byte, fn func(field uint64, value uint64, payload []byte) error) error {
+	for len(data) != 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("bad_binary_block")
+		}
+		data = data[n:]
+		var value uint64
+		var payload []byte
+		switch tag & 7 {
+		case wire_varint:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("bad_binary_block")
+			}
+			data = data[n:]
+		case wire_bytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errors.New("bad_binary_block")
+			}
+			payload = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return errors.New("bad_binary_block")
+		}
+		if err := fn(tag>>3, value, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package p2
+
+import "testing"
+
+func TestBinaryRoundTrip(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "binary?")
+	b.playerList = "2 3 "
+	b.minorList["1"] = "secret"
+	decoded, err := DecodeFromBinary(b.EncodeToBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_block(t, b, decoded)
+	if err := decoded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.EncodeToBinary()) >= len(b.EncodeToJson()) {
+		t.Fatalf("binary %d bytes, json %d bytes", len(b.EncodeToBinary()), len(b.EncodeToJson()))
+	}
+}
+
+func TestBinaryKeepsNodes(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "binary?")
+	result := b.ToJson()
+	nodes := b.Value.ExportNodes()
+	result.Nodes = &nodes
+	data, err := result.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := BlockJson{}
+	if err := other.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if other.Nodes == nil || other.Nodes.Root != nodes.Root || len(other.Nodes.Nodes) != len(nodes.Nodes) {
+		t.Fatalf("nodes %+v, want %+v", other.Nodes, nodes)
+	}
+	for i := range nodes.Nodes {
+		if other.Nodes.Nodes[i] != nodes.Nodes[i] {
+			t.Fatalf("node %d is %s, want %s", i, other.Nodes.Nodes[i], nodes.Nodes[i])
+		}
+	}
+}
+
+func TestBinaryChain(t *testing.T) {
+	use_memory_store(t)
+	genesis := test_block(1, "genesis", "first")
+	bc := NewBlockChain()
+	bc.Insert(genesis)
+	bc.Insert(test_block(2, genesis.Header.Hash, "second"))
+	data, err := bc.EncodeToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := DecodeBinaryToBlockChain(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Length != 2 || len(other.GetChildren(genesis.Header.Hash)) != 1 {
+		t.Fatalf("length %d, %d children of genesis", other.Length, len(other.GetChildren(genesis.Header.Hash)))
+	}
+
+	// a cut stream is an error, not a shorter chain
+	if _, err := DecodeBinaryToBlockChain(data[:len(data)-1]); err == nil {
+		t.Fatal("decoded a cut stream")
+	}
+}
+
+func TestEmptyChainJson(t *testing.T) {
+	encoded, err := NewBlockChain().EncodeToJson()
+	if err != nil || encoded != "[]" {
+		t.Fatalf("empty chain encodes to %q, %v", encoded, err)
+	}
+}
@@ -0,0 +1,256 @@
+package p2
+
+import "strings"
+
+// ForkRule decides which of the chains in a BlockChain is the canonical one
+type ForkRule int
+
+const (
+	// LongestChain picks the highest block, ties go to the smallest hash
+	LongestChain ForkRule = iota
+	// MostPlayed picks the chain with the most players over all its blocks,
+	// ties go to the longest chain, then to the smallest hash
+	MostPlayed
+)
+
+// ReorgEvent tells that the canonical head moved. Added are the blocks that became
+// canonical and Dropped the ones that stopped being, both from the head down to the
+// common ancestor. Dropped is empty when the new head simply extends the old one.
+type ReorgEvent struct {
+	OldHead  string
+	NewHead  string
+	Ancestor string
+	Added    []string
+	Dropped  []string
+}
+
+func (bc *BlockChain) SetForkRule(rule ForkRule) {
+	bc.rule = rule
+	bc.updateHead()
+}
+
+// OnReorg registers fn to be called every time the canonical head changes. fn runs while
+// the chain is being changed, it must not call back into it.
+func (bc *BlockChain) OnReorg(fn func(event ReorgEvent)) {
+	bc.reorgListeners = append(bc.reorgListeners, fn)
+}
+
+// CanonicalHead returns the last block of the canonical chain, false if the chain is empty
+func (bc *BlockChain) CanonicalHead() (Block, bool) {
+	if bc.head == "" {
+		return Block{}, false
+	}
+	return bc.GetBlockByHash(bc.head)
+}
+
+// IsCanonical tells if the block with this hash is on the canonical chain
+func (bc *BlockChain) IsCanonical(hash string) bool {
+	if bc.canonical == nil {
+		bc.canonical = map[string]bool{}
+		for _, h := range bc.ancestors(bc.head) {
+			bc.canonical[h] = true
+		}
+	}
+	return bc.canonical[hash]
+}
+
+// CanonicalChain returns the canonical chain from the head down to the first block
+func (bc *BlockChain) CanonicalChain() []Block {
+	chain := []Block{}
+	for _, hash := range bc.ancestors(bc.head) {
+		block, _ := bc.GetBlockByHash(hash)
+		chain = append(chain, block)
+	}
+	return chain
+}
+
+// Replace swaps the blocks of bc for the ones of other, keeping the fork rule and listeners
+func (bc *BlockChain) Replace(other *BlockChain) {
+	old := &BlockChain{Chain: bc.Chain, Length: bc.Length, byHash: bc.byHash, children: bc.children}
+	bc.Chain = other.Chain
+	bc.Length = other.Length
+	bc.byHash = nil
+	bc.canonical = nil
+	bc.moveHead(old)
+}
+
+// hashes of block hash and of all its ancestors that are in the chain, newest first
+func (bc *BlockChain) ancestors(hash string) []string {
+	ret := []string{}
+	for hash != "" {
+		block, found := bc.GetBlockByHash(hash)
+		if !found {
+			break
+		}
+		ret = append(ret, hash)
+		hash = block.Header.ParentHash
+	}
+	return ret
+}
+
+// players counts the players of the block with this hash and of all its ancestors
+func (bc *BlockChain) players(hash string) int {
+	count := 0
+	for _, h := range bc.ancestors(hash) {
+		block, _ := bc.GetBlockByHash(h)
+		count += len(strings.Fields(block.playerList))
+	}
+	return count
+}
+
+// headScore is what the fork rule compares two candidate heads by
+type headScore struct {
+	players int // of the block and all its ancestors, only counted under MostPlayed
+	height  int32
+	hash    string
+}
+
+// beats tells if head a wins over head b under the fork rule
+func (bc *BlockChain) beats(a headScore, b headScore) bool {
+	if bc.rule == MostPlayed && a.players != b.players {
+		return a.players > b.players
+	}
+	if a.height != b.height {
+		return a.height > b.height
+	}
+	return a.hash < b.hash
+}
+
+// bestBelow returns the best head among block and its descendants, base is the number of
+// players of the ancestors of block. Each block of the subtree is visited once.
+func (bc *BlockChain) bestBelow(block *Block, base int) headScore {
+	best := headScore{height: block.Header.Height, hash: block.Header.Hash}
+	if bc.rule == MostPlayed {
+		best.players = base + len(strings.Fields(block.playerList))
+	}
+	own := best.players
+	for _, hash := range bc.children[block.Header.Hash] {
+		if child := bc.blockByHash(hash); child != nil {
+			if score := bc.bestBelow(child, own); bc.beats(score, best) {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+// updateHead applies the fork rule to every block again and tells the listeners if the
+// head moved, for when the rule changed or the blocks were loaded without it
+func (bc *BlockChain) updateHead() {
+	bc.moveHead(bc)
+}
+
+// considerBranch updates the head after the block with this hash was inserted or got
+// players. Every other block is as it was, so only that block and its descendants can
+// beat the current head, and only they are compared with it.
+func (bc *BlockChain) considerBranch(hash string) {
+	block := bc.blockByHash(hash)
+	if block == nil {
+		return
+	}
+	base := 0
+	if bc.rule == MostPlayed {
+		base = bc.players(block.Header.ParentHash)
+	}
+	candidate := bc.bestBelow(block, base)
+	head := bc.blockByHash(bc.head)
+	if head == nil {
+		bc.setHead(candidate.hash, bc)
+		return
+	}
+	current := headScore{height: head.Header.Height, hash: head.Header.Hash}
+	if bc.rule == MostPlayed {
+		current.players = bc.players(bc.head)
+	}
+	if bc.beats(candidate, current) {
+		bc.setHead(candidate.hash, bc)
+	}
+}
+
+// blockInserted updates the head after b was inserted
+func (bc *BlockChain) blockInserted(b *Block) {
+	for _, child := range bc.children[b.Header.Hash] {
+		if bc.canonical[child] {
+			// a missing ancestor of the head came late, the canonical chain grew below
+			bc.canonical = nil
+		}
+	}
+	bc.considerBranch(b.Header.Hash)
+}
+
+// playersChanged updates the head after the block with this hash got players. A block
+// of the canonical chain gives its players to the head as well, the head stays.
+func (bc *BlockChain) playersChanged(hash string) {
+	if bc.rule == MostPlayed && !bc.IsCanonical(hash) {
+		bc.considerBranch(hash)
+	}
+}
+
+// moveHead looks at every block for the best head, old holds the blocks of before the change.
+// Each tree of blocks is walked once from its first block, counting players on the way down.
+func (bc *BlockChain) moveHead(old *BlockChain) {
+	bc.buildIndex()
+	best := headScore{}
+	found := false
+	for _, blocks := range bc.Chain {
+		for i := range blocks {
+			if bc.HasBlock(blocks[i].Header.ParentHash) {
+				continue
+			}
+			if score := bc.bestBelow(&blocks[i], 0); !found || bc.beats(score, best) {
+				best = score
+				found = true
+			}
+		}
+	}
+	bc.setHead(best.hash, old)
+}
+
+// setHead moves the head and tells the listeners. Both heads are walked back together,
+// the higher one first, until they meet, so the cost is the depth of the reorg only.
+// The old head is looked up in old, which is bc itself unless the blocks were replaced.
+func (bc *BlockChain) setHead(new_head string, old *BlockChain) {
+	if new_head == bc.head {
+		return
+	}
+	event := ReorgEvent{OldHead: bc.head, NewHead: new_head, Added: []string{}, Dropped: []string{}}
+	a, a_found := bc.GetBlockByHash(new_head)
+	b, b_found := old.GetBlockByHash(bc.head)
+	for a_found && b_found && a.Header.Hash != b.Header.Hash {
+		height := a.Header.Height
+		if b.Header.Height > height {
+			height = b.Header.Height
+		}
+		if a.Header.Height == height {
+			event.Added = append(event.Added, a.Header.Hash)
+			a, a_found = bc.GetBlockByHash(a.Header.ParentHash)
+		}
+		if b.Header.Height == height {
+			event.Dropped = append(event.Dropped, b.Header.Hash)
+			b, b_found = old.GetBlockByHash(b.Header.ParentHash)
+		}
+	}
+	if a_found && b_found {
+		event.Ancestor = a.Header.Hash
+	} else {
+		// no common block, the rest of both chains changed
+		for ; a_found; a, a_found = bc.GetBlockByHash(a.Header.ParentHash) {
+			event.Added = append(event.Added, a.Header.Hash)
+		}
+		for ; b_found; b, b_found = old.GetBlockByHash(b.Header.ParentHash) {
+			event.Dropped = append(event.Dropped, b.Header.Hash)
+		}
+	}
+	bc.head = new_head
+	if bc.canonical != nil {
+		for _, hash := range event.Dropped {
+			delete(bc.canonical, hash)
+		}
+		for _, hash := range event.Added {
+			bc.canonical[hash] = true
+		}
+	}
+	for _, fn := range bc.reorgListeners {
+		fn(event)
+	}
+}
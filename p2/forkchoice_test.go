@@ -0,0 +1,163 @@
+package p2
+
+import (
+	"reflect"
+	"testing"
+)
+
+// grow makes the next block on parent
+func grow(parent *Block, question string) *Block {
+	return test_block(parent.Header.Height+1, parent.Header.Hash, question)
+}
+
+func record_reorgs(bc *BlockChain) *[]ReorgEvent {
+	events := []ReorgEvent{}
+	bc.OnReorg(func(event ReorgEvent) {
+		events = append(events, event)
+	})
+	return &events
+}
+
+func check_head(t *testing.T, bc *BlockChain, want *Block) {
+	t.Helper()
+	head, found := bc.CanonicalHead()
+	if !found || head.Header.Hash != want.Header.Hash {
+		t.Fatalf("head %s at height %d, want %s at height %d", head.Header.Hash, head.Header.Height, want.Header.Hash, want.Header.Height)
+	}
+	for hash := want.Header.Hash; hash != "genesis"; {
+		if !bc.IsCanonical(hash) {
+			t.Fatalf("%s is below the head but not canonical", hash)
+		}
+		block, _ := bc.GetBlockByHash(hash)
+		hash = block.Header.ParentHash
+	}
+}
+
+func hashes(blocks ...*Block) []string {
+	ret := []string{}
+	for _, b := range blocks {
+		ret = append(ret, b.Header.Hash)
+	}
+	return ret
+}
+
+func TestLongestChainReorg(t *testing.T) {
+	use_memory_store(t)
+	bc := NewBlockChain()
+	events := record_reorgs(bc)
+	g := test_block(1, "genesis", "g")
+	a1 := grow(g, "a1")
+	a2 := grow(a1, "a2")
+	for _, b := range []*Block{g, a1, a2} {
+		bc.Insert(b)
+	}
+	check_head(t, bc, a2)
+	if n := len(*events); n != 3 || len((*events)[2].Dropped) != 0 || !reflect.DeepEqual((*events)[2].Added, hashes(a2)) {
+		t.Fatalf("extending the chain: %+v", *events)
+	}
+
+	b1 := grow(g, "b1")
+	b2 := grow(b1, "b2")
+	b3 := grow(b2, "b3")
+	*events = nil
+	for _, b := range []*Block{b1, b2, b3} {
+		bc.Insert(b)
+	}
+	check_head(t, bc, b3)
+	for _, b := range []*Block{a1, a2} {
+		if bc.IsCanonical(b.Header.Hash) {
+			t.Errorf("%s still canonical after the reorg", b.Header.Hash)
+		}
+	}
+	// b2 ties with a2 at height 3 and takes the head if its hash is smaller
+	reorg := (*events)[0]
+	if reorg.OldHead != a2.Header.Hash || reorg.Ancestor != g.Header.Hash || !reflect.DeepEqual(reorg.Dropped, hashes(a2, a1)) {
+		t.Fatalf("reorg %+v", reorg)
+	}
+	if b2.Header.Hash < a2.Header.Hash {
+		if len(*events) != 2 || !reflect.DeepEqual(reorg.Added, hashes(b2, b1)) {
+			t.Fatalf("reorgs %+v", *events)
+		}
+	} else if len(*events) != 1 || !reflect.DeepEqual(reorg.Added, hashes(b3, b2, b1)) {
+		t.Fatalf("reorgs %+v", *events)
+	}
+}
+
+// two heads at the same height go to the smallest hash, whatever the order they came in
+func TestLongestChainTieBreak(t *testing.T) {
+	use_memory_store(t)
+	g := test_block(1, "genesis", "g")
+	a := grow(g, "a")
+	b := grow(g, "b")
+	want := a
+	if b.Header.Hash < a.Header.Hash {
+		want = b
+	}
+	for _, order := range [][]*Block{{g, a, b}, {g, b, a}} {
+		bc := NewBlockChain()
+		for _, block := range order {
+			bc.Insert(block)
+		}
+		check_head(t, bc, want)
+	}
+}
+
+func TestMostPlayed(t *testing.T) {
+	use_memory_store(t)
+	bc := NewBlockChain()
+	bc.SetForkRule(MostPlayed)
+	events := record_reorgs(bc)
+	g := test_block(1, "genesis", "g")
+	a1 := grow(g, "a1")
+	b1 := grow(g, "b1")
+	b2 := grow(b1, "b2")
+	for _, b := range []*Block{g, a1, b1, b2} {
+		bc.Insert(b)
+	}
+	// nobody played, the longest chain wins
+	check_head(t, bc, b2)
+
+	*events = nil
+	bc.AddPlayer("7", a1.Header.Height, a1.Header.Hash)
+	check_head(t, bc, a1)
+	if len(*events) != 1 || !reflect.DeepEqual((*events)[0].Dropped, hashes(b2, b1)) ||
+		!reflect.DeepEqual((*events)[0].Added, hashes(a1)) || (*events)[0].Ancestor != g.Header.Hash {
+		t.Fatalf("reorgs %+v", *events)
+	}
+
+	// one player on each side, the tie goes to the longest chain
+	bc.AddPlayer("8", b1.Header.Height, b1.Header.Hash)
+	check_head(t, bc, b2)
+
+	// players of a canonical block count for the head too
+	*events = nil
+	bc.AddPlayer("9", g.Header.Height, g.Header.Hash)
+	bc.AddPlayer("9", b2.Header.Height, b2.Header.Hash)
+	check_head(t, bc, b2)
+	if len(*events) != 0 {
+		t.Fatalf("head moved for players of the canonical chain: %+v", *events)
+	}
+
+	// the rule is applied to every block again when it changes
+	bc.AddPlayer("10", a1.Header.Height, a1.Header.Hash)
+	bc.AddPlayer("11", a1.Header.Height, a1.Header.Hash)
+	check_head(t, bc, a1)
+	bc.SetForkRule(LongestChain)
+	check_head(t, bc, b2)
+}
+
+// the canonical chain grows below the head when a missing ancestor comes late
+func TestCanonicalLateAncestor(t *testing.T) {
+	use_memory_store(t)
+	g := test_block(1, "genesis", "g")
+	a1 := grow(g, "a1")
+	a2 := grow(a1, "a2")
+	bc := NewBlockChain()
+	bc.Insert(g)
+	bc.Insert(a2)
+	if !bc.IsCanonical(a2.Header.Hash) || bc.IsCanonical(g.Header.Hash) {
+		t.Fatal("canonical chain of a head without parent")
+	}
+	bc.Insert(a1)
+	check_head(t, bc, a2)
+}
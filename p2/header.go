@@ -0,0 +1,83 @@
+package p2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HEADER_VERSION is the header encoding new blocks are hashed with
+const HEADER_VERSION uint8 = 1
+
+// Canonical header encoding, version 1. The block hash is the SHA3-256 of:
+//   version (1 byte)
+//   height (4 bytes), timeStamp (8 bytes), size (4 bytes), all big endian
+//   parentHash, root, creator, each a uvarint length and the bytes
+//   rank as a uvarint count, then per id in sorted order the id (uvarint length and
+//   bytes) and its rank (4 bytes)
+// That is every field of the header but Hash. The players and secrets of a block change
+// after it is made, they are kept on the Block instead, see Block.playerList.
+func (header *Header) Encode() ([]byte, error) {
+	if header.Version != HEADER_VERSION {
+		return nil, errors.New("unknown_header_version")
+	}
+	buf := bytes.Buffer{}
+	buf.WriteByte(header.Version)
+	binary.Write(&buf, binary.BigEndian, header.Height)
+	binary.Write(&buf, binary.BigEndian, header.TimeStamp)
+	binary.Write(&buf, binary.BigEndian, header.Size)
+	write_string(&buf, header.ParentHash)
+	write_string(&buf, header.Root)
+	write_string(&buf, header.creator)
+	ids := []string{}
+	for id := range header.rank {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	write_uvarint(&buf, uint64(len(ids)))
+	for _, id := range ids {
+		write_string(&buf, id)
+		binary.Write(&buf, binary.BigEndian, header.rank[id])
+	}
+	return buf.Bytes(), nil
+}
+
+// ComputeHash hashes the canonical encoding of the header, Hash itself is left out
+func (header *Header) ComputeHash() (string, error) {
+	encoded, err := header.Encode()
+	if err != nil {
+		return "", err
+	}
+	sum := sha3.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify recomputes the hash of the block and checks it against the one it carries,
+// and that the header root is the root of the block's MPT
+func (b *Block) Verify() error {
+	if b.Header.Root != b.Value.Get_root() {
+		return errors.New("root_mismatch")
+	}
+	hash, err := b.Header.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if hash != b.Header.Hash {
+		return errors.New("hash_mismatch")
+	}
+	return nil
+}
+
+func write_uvarint(buf *bytes.Buffer, x uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	buf.Write(tmp[:binary.PutUvarint(tmp, x)])
+}
+
+func write_string(buf *bytes.Buffer, s string) {
+	write_uvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
@@ -0,0 +1,66 @@
+package p2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyCatchesTampering(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "question")
+	if err := b.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	// every field of the header but Hash feeds the hash
+	changes := map[string]func(h *Header){
+		"height":     func(h *Header) { h.Height++ },
+		"timeStamp":  func(h *Header) { h.TimeStamp++ },
+		"parentHash": func(h *Header) { h.ParentHash = "other" },
+		"size":       func(h *Header) { h.Size++ },
+		"creator":    func(h *Header) { h.creator = "2" },
+		"rank":       func(h *Header) { h.rank = map[string]int32{"1": 1, "2": 1} },
+		"rank id":    func(h *Header) { h.rank = map[string]int32{"1": 1, "3": 0} },
+	}
+	for name, change := range changes {
+		tampered := *b
+		change(&tampered.Header)
+		if err := tampered.Verify(); err == nil || err.Error() != "hash_mismatch" {
+			t.Errorf("verify with %s changed: %v", name, err)
+		}
+	}
+	tampered := *b
+	tampered.Header.Version = 2
+	if err := tampered.Verify(); err == nil {
+		t.Error("verified a header of an unknown version")
+	}
+	// players and secrets are on the block, not in the header
+	tampered = *b
+	tampered.playerList = "2 "
+	tampered.minorList = map[string]string{"1": "secret"}
+	if err := tampered.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a chain with a block that does not verify is refused whole, not cut at that block
+func TestDecodeChainRejectsTamperedBlock(t *testing.T) {
+	use_memory_store(t)
+	genesis := test_block(1, "genesis", "first")
+	bc := NewBlockChain()
+	bc.Insert(genesis)
+	bc.Insert(test_block(2, genesis.Header.Hash, "second"))
+	encoded, err := bc.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeJsonToBlockChain(encoded); err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(encoded, `"timeStamp":1550013939`, `"timeStamp":1550013999`, 1)
+	if tampered == encoded {
+		t.Fatal("nothing to tamper with in " + encoded)
+	}
+	if other, err := DecodeJsonToBlockChain(tampered); err == nil {
+		t.Fatalf("decoded a tampered chain of length %d", other.Length)
+	}
+}
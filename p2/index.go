@@ -0,0 +1,79 @@
+package p2
+
+// blockRef is where a block sits in Chain: Chain[height][position]. Blocks are stored
+// by value and changed in place (players, secrets), so the index points at the slot
+// instead of keeping a copy.
+type blockRef struct {
+	height   int32
+	position int
+}
+
+// buildIndex fills the hash index and the children lists from Chain. It runs on first
+// use, so a BlockChain whose Chain was set directly gets indexed too.
+func (bc *BlockChain) buildIndex() {
+	if bc.byHash != nil {
+		return
+	}
+	bc.byHash = map[string]blockRef{}
+	bc.children = map[string][]string{}
+	for height, blocks := range bc.Chain {
+		for position, block := range blocks {
+			bc.byHash[block.Header.Hash] = blockRef{height: height, position: position}
+			bc.children[block.Header.ParentHash] = append(bc.children[block.Header.ParentHash], block.Header.Hash)
+		}
+	}
+}
+
+// HasBlock tells if the block with this hash is in the chain
+func (bc *BlockChain) HasBlock(hash string) bool {
+	bc.buildIndex()
+	_, found := bc.byHash[hash]
+	return found
+}
+
+// GetBlockByHash finds a block by its hash, whatever its height
+func (bc *BlockChain) GetBlockByHash(hash string) (Block, bool) {
+	bc.buildIndex()
+	ref, found := bc.byHash[hash]
+	if !found {
+		return Block{}, false
+	}
+	return bc.Chain[ref.height][ref.position], true
+}
+
+// GetChildren returns the blocks whose parent is the block with this hash
+func (bc *BlockChain) GetChildren(hash string) []Block {
+	bc.buildIndex()
+	ret := []Block{}
+	for _, child := range bc.children[hash] {
+		block, _ := bc.GetBlockByHash(child)
+		ret = append(ret, block)
+	}
+	return ret
+}
+
+// IsOrphan tells if the parent of b is missing from the chain
+func (bc *BlockChain) IsOrphan(b *Block) bool {
+	return b.Header.ParentHash != "genesis" && !bc.HasBlock(b.Header.ParentHash)
+}
+
+// blockByHash points at the stored block, nil if the chain has no block with this hash
+func (bc *BlockChain) blockByHash(hash string) *Block {
+	bc.buildIndex()
+	ref, found := bc.byHash[hash]
+	if !found {
+		return nil
+	}
+	return &bc.Chain[ref.height][ref.position]
+}
+
+// getBlockRef points at the stored block so it can be changed in place, nil if the
+// chain has no block with this hash at this height
+func (bc *BlockChain) getBlockRef(height int32, hash string) *Block {
+	bc.buildIndex()
+	ref, found := bc.byHash[hash]
+	if !found || ref.height != height {
+		return nil
+	}
+	return &bc.Chain[ref.height][ref.position]
+}
@@ -0,0 +1,87 @@
+package p2
+
+import "testing"
+
+func check_index(t *testing.T, bc *BlockChain, in []*Block, out []*Block) {
+	t.Helper()
+	for _, b := range in {
+		block, found := bc.GetBlockByHash(b.Header.Hash)
+		if !found || block.Header.Hash != b.Header.Hash || !bc.HasBlock(b.Header.Hash) {
+			t.Fatalf("block %s at height %d not found", b.Header.Hash, b.Header.Height)
+		}
+		if ref := bc.getBlockRef(b.Header.Height, b.Header.Hash); ref == nil || ref.Header.Hash != b.Header.Hash {
+			t.Fatalf("no reference to block %s", b.Header.Hash)
+		}
+	}
+	for _, b := range out {
+		if _, found := bc.GetBlockByHash(b.Header.Hash); found || bc.HasBlock(b.Header.Hash) {
+			t.Fatalf("block %s found after it was dropped", b.Header.Hash)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	use_memory_store(t)
+	g := test_block(1, "genesis", "g")
+	a := grow(g, "a")
+	b := grow(g, "b")
+	c := grow(a, "c")
+	bc := NewBlockChain()
+	for _, block := range []*Block{g, a, b, c} {
+		bc.Insert(block)
+	}
+	check_index(t, bc, []*Block{g, a, b, c}, nil)
+	if children := bc.GetChildren(g.Header.Hash); len(children) != 2 {
+		t.Fatalf("%d children of the first block", len(children))
+	}
+	if bc.getBlockRef(3, a.Header.Hash) != nil {
+		t.Fatal("found a block at the wrong height")
+	}
+	// the reference is the stored block, players added through it stay
+	bc.AddPlayer("7", a.Header.Height, a.Header.Hash)
+	if block, _ := bc.GetBlockByHash(a.Header.Hash); block.playerList != "7 " {
+		t.Fatalf("players %q", block.playerList)
+	}
+}
+
+func TestIndexAfterReplace(t *testing.T) {
+	use_memory_store(t)
+	g := test_block(1, "genesis", "g")
+	a := grow(g, "a")
+	b := grow(g, "b")
+	c := grow(b, "c")
+	bc := NewBlockChain()
+	for _, block := range []*Block{g, a} {
+		bc.Insert(block)
+	}
+	check_index(t, bc, []*Block{g, a}, nil)
+
+	other := NewBlockChain()
+	for _, block := range []*Block{c, b, g} {
+		other.Insert(block)
+	}
+	bc.Replace(other)
+	check_index(t, bc, []*Block{g, b, c}, []*Block{a})
+	if children := bc.GetChildren(g.Header.Hash); len(children) != 1 || children[0].Header.Hash != b.Header.Hash {
+		t.Fatalf("children of the first block %v", hashes(&children[0]))
+	}
+	check_head(t, bc, c)
+	if bc.IsCanonical(a.Header.Hash) {
+		t.Fatal("a dropped block is canonical")
+	}
+
+	// the index keeps up with blocks inserted after the replace
+	d := grow(a, "d")
+	bc.Insert(a)
+	bc.Insert(d)
+	check_index(t, bc, []*Block{g, a, b, c, d}, nil)
+}
+
+// a chain whose Chain is set directly is indexed on first use
+func TestIndexOfChainSetDirectly(t *testing.T) {
+	use_memory_store(t)
+	g := test_block(1, "genesis", "g")
+	a := grow(g, "a")
+	bc := &BlockChain{Chain: map[int32][]Block{1: {*g}, 2: {*a}}, Length: 2}
+	check_index(t, bc, []*Block{g, a}, nil)
+}
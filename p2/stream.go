@@ -0,0 +1,115 @@
+package p2
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// NDJSON_CONTENT_TYPE is a chain sent as newline delimited JSON, one block per line in the
+// wire format of Block.ToJson, lower heights first. Unlike a JSON array it can be written
+// and read one block at a time.
+const NDJSON_CONTENT_TYPE = "application/x-ndjson"
+
+// JsonBlockWriter writes blocks as newline delimited JSON. With nodes every line carries
+// the MPT nodes of its block too, so the stream does not depend on any peer, e.g. a backup.
+type JsonBlockWriter struct {
+	encoder   *json.Encoder
+	withNodes bool
+}
+
+func NewJsonBlockWriter(w io.Writer, withNodes bool) *JsonBlockWriter {
+	return &JsonBlockWriter{encoder: json.NewEncoder(w), withNodes: withNodes}
+}
+
+func (writer *JsonBlockWriter) Write(b *Block) error {
+	result := b.ToJson()
+	if writer.withNodes {
+		nodes := b.Value.ExportNodes()
+		result.Nodes = &nodes
+	}
+	return writer.encoder.Encode(result)
+}
+
+// JsonBlockReader reads the blocks written by a JsonBlockWriter
+type JsonBlockReader struct {
+	decoder *json.Decoder
+}
+
+func NewJsonBlockReader(r io.Reader) *JsonBlockReader {
+	return &JsonBlockReader{decoder: json.NewDecoder(r)}
+}
+
+// Read returns the next block, io.EOF once the stream ended
+func (reader *JsonBlockReader) Read() (*Block, error) {
+	var result BlockJson
+	if err := reader.decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.ToBlock()
+}
+
+// Hashes lists the hashes of all blocks, lower heights first
+func (bc *BlockChain) Hashes() []string {
+	ret := []string{}
+	for _, block := range bc.blocksInOrder() {
+		ret = append(ret, block.Header.Hash)
+	}
+	return ret
+}
+
+// Export writes every block of the chain to w, see NDJSON_CONTENT_TYPE
+func (bc *BlockChain) Export(w io.Writer, withNodes bool) error {
+	writer := NewJsonBlockWriter(w, withNodes)
+	for _, block := range bc.blocksInOrder() {
+		if err := writer.Write(&block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import reads blocks from r and inserts them one by one, each validated against the
+// blocks before it. Blocks already in the chain are skipped. It stops at the first block
+// that cannot be read or is not valid and returns how many blocks were inserted until then.
+func (bc *BlockChain) Import(r io.Reader) (int, error) {
+	if bc.Chain == nil {
+		bc.Chain = make(map[int32][]Block)
+		bc.byHash = nil
+	}
+	return ImportBlocks(r, func(b *Block) (bool, error) {
+		if bc.HasBlock(b.Header.Hash) {
+			return false, nil
+		}
+		if err := bc.Validate(b); err != nil {
+			return false, err
+		}
+		bc.Insert(b)
+		return true, nil
+	})
+}
+
+// ImportBlocks reads the blocks of a newline delimited JSON stream and hands them to insert
+// one by one, insert tells if the block was new. It stops at the first error and returns
+// how many blocks were new until then.
+func ImportBlocks(r io.Reader, insert func(b *Block) (bool, error)) (int, error) {
+	reader := NewJsonBlockReader(r)
+	count := 0
+	for i := 1; ; i++ {
+		block, err := reader.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, errors.New("block " + strconv.Itoa(i) + " cannot be read: " + err.Error())
+		}
+		added, err := insert(block)
+		if err != nil {
+			return count, errors.New("block " + strconv.Itoa(i) + " " + block.Header.Hash + ": " + err.Error())
+		}
+		if added {
+			count++
+		}
+	}
+}
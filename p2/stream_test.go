@@ -0,0 +1,67 @@
+package p2
+
+import (
+	"bytes"
+	"testing"
+)
+
+// a genesis block with two children, inserted children first
+func test_chain() (*BlockChain, *Block) {
+	genesis := test_block(1, "genesis", "first")
+	genesis.playerList = "2 "
+	genesis.minorList["1"] = "secret"
+	bc := NewBlockChain()
+	bc.Insert(test_block(2, genesis.Header.Hash, "second"))
+	bc.Insert(test_block(2, genesis.Header.Hash, "other second"))
+	bc.Insert(genesis)
+	return bc, genesis
+}
+
+func TestExportImport(t *testing.T) {
+	use_memory_store(t)
+	bc, genesis := test_chain()
+	buf := bytes.Buffer{}
+	if err := bc.Export(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 3 {
+		t.Fatalf("%d lines for 3 blocks", lines)
+	}
+
+	// parents come first, so every block can be validated as it is read, and the nodes
+	// travel with the blocks
+	use_memory_store(t)
+	other := NewBlockChain()
+	count, err := other.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil || count != 3 {
+		t.Fatalf("imported %d blocks: %v", count, err)
+	}
+	block, _ := other.GetBlockByHash(genesis.Header.Hash)
+	check_block(t, genesis, &block)
+	if value, err := block.Value.Get("question"); err != nil || value != "first" {
+		t.Fatalf("question %q, %v", value, err)
+	}
+
+	count, err = other.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil || count != 0 {
+		t.Fatalf("imported %d blocks again: %v", count, err)
+	}
+}
+
+// a block without its parent stops the import, the ones before it stay
+func TestImportStopsAtInvalidBlock(t *testing.T) {
+	use_memory_store(t)
+	bc, _ := test_chain()
+	buf := bytes.Buffer{}
+	bc.Export(&buf, true)
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	broken := append(append([]byte{}, lines[1]...), lines[0]...)
+
+	other := NewBlockChain()
+	if count, err := other.Import(bytes.NewReader(broken)); err == nil || count != 0 {
+		t.Fatalf("imported %d blocks of a broken stream: %v", count, err)
+	}
+	if count, err := other.Import(bytes.NewReader(lines[0])); err != nil || count != 1 {
+		t.Fatalf("imported %d blocks: %v", count, err)
+	}
+}
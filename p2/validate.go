@@ -0,0 +1,91 @@
+package p2
+
+import "fmt"
+
+// MAX_BLOCK_SIZE is the largest Size a block may have
+const MAX_BLOCK_SIZE = 1 << 20
+
+// MAX_CLOCK_DRIFT is how far in the future (seconds) a block's timestamp may be
+const MAX_CLOCK_DRIFT = 60
+
+// RejectReason says which check a block failed
+type RejectReason string
+
+const (
+	RejectBadHash      RejectReason = "bad_hash"
+	RejectBadRoot      RejectReason = "bad_root"
+	RejectNoParent     RejectReason = "no_parent"
+	RejectBadHeight    RejectReason = "bad_height"
+	RejectBadTimestamp RejectReason = "bad_timestamp"
+	RejectBadSize      RejectReason = "bad_size"
+	RejectBadRank      RejectReason = "bad_rank"
+)
+
+// BlockError is returned by Validate, Reason is meant for code and Detail for people
+type BlockError struct {
+	Reason RejectReason
+	Detail string
+}
+
+func (err *BlockError) Error() string {
+	return string(err.Reason) + ": " + err.Detail
+}
+
+func reject(reason RejectReason, format string, a ...interface{}) error {
+	return &BlockError{Reason: reason, Detail: fmt.Sprintf(format, a...)}
+}
+
+// Validate checks a received block against the chain before it is inserted:
+// its hash and root, its height and timestamp against its parent, its size, and that its
+// rank is the parent's rank with the creator, and only the creator, one higher.
+// The parent must already be in the chain, a block whose ParentHash is "genesis" has none.
+func (bc *BlockChain) Validate(b *Block) error {
+	if err := b.Verify(); err != nil {
+		if err.Error() == "root_mismatch" {
+			return reject(RejectBadRoot, "header root %s, mpt root %s", b.Header.Root, b.Value.Get_root())
+		}
+		return reject(RejectBadHash, "%s", err.Error())
+	}
+
+	parent := Block{}
+	if b.Header.ParentHash != "genesis" {
+		var found bool
+		parent, found = bc.GetBlockByHash(b.Header.ParentHash)
+		if !found {
+			return reject(RejectNoParent, "parent %s not in the chain", b.Header.ParentHash)
+		}
+	}
+	if b.Header.Height != parent.Header.Height+1 {
+		return reject(RejectBadHeight, "height %d after parent height %d", b.Header.Height, parent.Header.Height)
+	}
+
+	if b.Header.TimeStamp < parent.Header.TimeStamp {
+		return reject(RejectBadTimestamp, "timestamp %d before parent timestamp %d", b.Header.TimeStamp, parent.Header.TimeStamp)
+	}
+	if now := BlockClock.Now().Unix(); b.Header.TimeStamp > now+MAX_CLOCK_DRIFT {
+		return reject(RejectBadTimestamp, "timestamp %d is in the future, now is %d", b.Header.TimeStamp, now)
+	}
+
+	if size := calculateSize(&b.Value); b.Header.Size != size || size > MAX_BLOCK_SIZE {
+		return reject(RejectBadSize, "size %d, mpt size %d, limit %d", b.Header.Size, size, MAX_BLOCK_SIZE)
+	}
+
+	for id, rank := range b.Header.rank {
+		want := parent.Header.rank[id]
+		if id == b.Header.creator {
+			want++
+		}
+		if rank != want {
+			return reject(RejectBadRank, "rank of %s is %d, expected %d", id, rank, want)
+		}
+	}
+	for id, rank := range parent.Header.rank {
+		if _, ok := b.Header.rank[id]; !ok && rank != 0 {
+			return reject(RejectBadRank, "rank of %s was dropped", id)
+		}
+	}
+	if _, ok := b.Header.rank[b.Header.creator]; !ok {
+		return reject(RejectBadRank, "creator %s has no rank", b.Header.creator)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package p2
+
+import (
+	"testing"
+	"time"
+
+	"../p1"
+)
+
+// child builds a block on parent with these fields, hashed like any new block
+func child(parent *Block, height int32, timeStamp int64, rank map[string]int32, creator string) *Block {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(TrieStore)
+	mpt.Insert("question", "child")
+	return NewBlock(height, timeStamp, parent.Header.Hash, mpt, rank, creator, "", map[string]string{})
+}
+
+// rehash gives the block a valid hash again after a header field was changed
+func rehash(b *Block) *Block {
+	b.Header.Hash, _ = b.Header.ComputeHash()
+	return b
+}
+
+func TestValidate(t *testing.T) {
+	use_memory_store(t)
+	genesis := test_block(1, "genesis", "first")
+	bc := NewBlockChain()
+	bc.Insert(genesis)
+	ts := genesis.Header.TimeStamp + 1
+	rank := map[string]int32{"1": 2, "2": 0}
+
+	other := p1.MerklePatriciaTrie{}
+	other.InitialWithStore(TrieStore)
+	other.Insert("question", "other")
+
+	cases := []struct {
+		name  string
+		block *Block
+		want  RejectReason
+	}{
+		{"valid", child(genesis, 2, ts, rank, "1"), ""},
+		{"valid, other creator", child(genesis, 2, ts, map[string]int32{"1": 1, "2": 1}, "2"), ""},
+		{"valid first block", test_block(1, "genesis", "another first"), ""},
+		{"hash", func() *Block { b := child(genesis, 2, ts, rank, "1"); b.Header.Hash = genesis.Header.Hash; return b }(), RejectBadHash},
+		{"root", func() *Block { b := child(genesis, 2, ts, rank, "1"); b.Value = other; return b }(), RejectBadRoot},
+		{"no parent", test_block(2, "unknown", "second"), RejectNoParent},
+		{"height", child(genesis, 3, ts, rank, "1"), RejectBadHeight},
+		{"timestamp before parent", child(genesis, 2, genesis.Header.TimeStamp-1, rank, "1"), RejectBadTimestamp},
+		{"timestamp in the future", child(genesis, 2, time.Now().Unix()+MAX_CLOCK_DRIFT+60, rank, "1"), RejectBadTimestamp},
+		{"size", func() *Block { b := child(genesis, 2, ts, rank, "1"); b.Header.Size++; return rehash(b) }(), RejectBadSize},
+		{"rank not raised", child(genesis, 2, ts, map[string]int32{"1": 1, "2": 0}, "1"), RejectBadRank},
+		{"rank of another raised", child(genesis, 2, ts, map[string]int32{"1": 2, "2": 1}, "1"), RejectBadRank},
+		{"rank dropped", child(genesis, 2, ts, map[string]int32{"2": 1}, "2"), RejectBadRank},
+		{"creator without rank", child(genesis, 2, ts, map[string]int32{"1": 1, "2": 0}, "3"), RejectBadRank},
+	}
+	for _, c := range cases {
+		err := bc.Validate(c.block)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+			continue
+		}
+		if blockErr, ok := err.(*BlockError); !ok || blockErr.Reason != c.want {
+			t.Errorf("%s: got %v, want %s", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package p2
+
+import (
+	"errors"
+
+	"../p1"
+)
+
+// WIRE_FORMAT is the version of the block JSON this node writes. Format 0 is the hand
+// built JSON of older peers, it has the same field names and is still read.
+const WIRE_FORMAT = 1
+
+// ToJson gives the wire form of the block with every header field, the players and the
+// secrets, the MPT is sent as its root only. The maps are copied, the result can be
+// changed freely.
+func (b *Block) ToJson() BlockJson {
+	return BlockJson{Format: WIRE_FORMAT, Height: b.Header.Height, Timestamp: b.Header.TimeStamp, Hash: b.Header.Hash,
+		ParentHash: b.Header.ParentHash, Creator: b.Header.creator, Size: b.Header.Size, Version: b.Header.Version,
+		Root: b.Header.Root, Rank: copy_rank(b.Header.rank), PlayerList: b.playerList,
+		MinorList: copy_minor(b.minorList)}
+}
+
+// ToBlock rebuilds the block, its MPT comes from Nodes, MPT or FetchNode in that order
+func (result *BlockJson) ToBlock() (*Block, error) {
+	if result.Format > WIRE_FORMAT {
+		return nil, errors.New("unknown_wire_format")
+	}
+	header := Header{Height: result.Height, TimeStamp: result.Timestamp, Hash: result.Hash, ParentHash: result.ParentHash,
+		Size: result.Size, Root: result.Root, Version: result.Version, rank: copy_rank(result.Rank), creator: result.Creator}
+	minorList := copy_minor(result.MinorList)
+	if minorList == nil {
+		minorList = map[string]string{}
+	}
+
+	mpt := p1.MerklePatriciaTrie{}
+	var err error
+	if result.Nodes != nil {
+		// the node graph is checked hash by hash against its advertised root
+		mpt, err = p1.ImportNodes(TrieStore, *result.Nodes)
+		if err != nil {
+			return nil, errors.New("mpt nodes of the block cannot be verified: " + err.Error())
+		}
+	} else if result.MPT != nil {
+		// older peers still send the key value pairs
+		mpt.InitialWithStore(TrieStore)
+		batch := mpt.NewBatch()
+		for key, value := range result.MPT {
+			batch.Put(key, value)
+		}
+		root, err := batch.Commit()
+		if err != nil {
+			return nil, errors.New("cannot build the mpt of the block: " + err.Error())
+		}
+		if result.Root != "" && root != result.Root {
+			return nil, errors.New("mpt of the block does not match its root")
+		}
+	} else {
+		// only the root is sent, the nodes are fetched by hash from the peers
+		fetch := FetchNode
+		if fetch == nil {
+			fetch = func(hash string) ([]byte, error) {
+				return nil, errors.New("no_node_source")
+			}
+		}
+		mpt, err = p1.SyncTrie(TrieStore, result.Root, fetch)
+		if err != nil {
+			return nil, errors.New("cannot sync the mpt of the block: " + err.Error())
+		}
+	}
+	if result.Root == "" {
+		// older peers do not send the root, it is the one of the mpt they sent
+		header.Root = mpt.Get_root()
+	}
+	return &Block{Header: header, Value: mpt, playerList: result.PlayerList, minorList: minorList}, nil
+}
+
+func copy_rank(rank map[string]int32) map[string]int32 {
+	if rank == nil {
+		return nil
+	}
+	ret := make(map[string]int32, len(rank))
+	for id, r := range rank {
+		ret[id] = r
+	}
+	return ret
+}
+
+func copy_minor(minor map[string]string) map[string]string {
+	if minor == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(minor))
+	for id, secret := range minor {
+		ret[id] = secret
+	}
+	return ret
+}
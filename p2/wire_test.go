@@ -0,0 +1,121 @@
+package p2
+
+import (
+	"fmt"
+	"testing"
+
+	"../p1"
+)
+
+// use_memory_store gives the test a TrieStore of its own
+func use_memory_store(t *testing.T) p1.NodeStore {
+	old := TrieStore
+	TrieStore = p1.NewMemoryStore()
+	t.Cleanup(func() { TrieStore = old })
+	return TrieStore
+}
+
+func test_block(height int32, parent string, question string) *Block {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(TrieStore)
+	mpt.Insert("question", question)
+	return NewBlock(height, 1550013937+int64(height), parent, mpt, map[string]int32{"1": height, "2": 0}, "1", "", map[string]string{})
+}
+
+// check_block fails unless the two blocks agree on every header field, the players and
+// the secrets
+func check_block(t *testing.T, want *Block, got *Block) {
+	t.Helper()
+	if want.Header.Height != got.Header.Height || want.Header.TimeStamp != got.Header.TimeStamp ||
+		want.Header.Hash != got.Header.Hash || want.Header.ParentHash != got.Header.ParentHash ||
+		want.Header.Size != got.Header.Size || want.Header.Root != got.Header.Root ||
+		want.Header.Version != got.Header.Version || want.Header.creator != got.Header.creator {
+		t.Fatalf("header %+v, want %+v", got.Header, want.Header)
+	}
+	if len(want.Header.rank) != len(got.Header.rank) {
+		t.Fatalf("rank %v, want %v", got.Header.rank, want.Header.rank)
+	}
+	for id, rank := range want.Header.rank {
+		if other, ok := got.Header.rank[id]; !ok || other != rank {
+			t.Fatalf("rank %v, want %v", got.Header.rank, want.Header.rank)
+		}
+	}
+	if want.playerList != got.playerList || len(want.minorList) != len(got.minorList) {
+		t.Fatalf("players %q secrets %v, want %q %v", got.playerList, got.minorList, want.playerList, want.minorList)
+	}
+	for id, secret := range want.minorList {
+		if other, ok := got.minorList[id]; !ok || other != secret {
+			t.Fatalf("secrets %v, want %v", got.minorList, want.minorList)
+		}
+	}
+}
+
+// check_round_trip encodes b alone and inside a chain, both must decode to the same block
+func check_round_trip(t *testing.T, b *Block) {
+	t.Helper()
+	decoded := DecodeFromJson(b.EncodeToJson())
+	if decoded == nil {
+		t.Fatalf("cannot decode %s", b.EncodeToJson())
+	}
+	check_block(t, b, decoded)
+	if decoded.Value.Get_root() != b.Value.Get_root() {
+		t.Fatalf("mpt root %s, want %s", decoded.Value.Get_root(), b.Value.Get_root())
+	}
+
+	bc := NewBlockChain()
+	bc.Insert(b)
+	encoded, err := bc.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewBlockChain()
+	if err := other.DecodeFromJson(encoded); err != nil {
+		t.Fatal(err)
+	}
+	block, found := other.GetBlockByHash(b.Header.Hash)
+	if !found {
+		t.Fatalf("block %s lost in the chain", b.Header.Hash)
+	}
+	check_block(t, b, &block)
+	if err := block.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", `do "quotes" survive?`)
+	check_round_trip(t, b)
+}
+
+// players join and the creator gets its secret after the block was made
+func TestWireRoundTripGameFields(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "question")
+	b.playerList = "2 3 "
+	b.minorList["1"] = `s3cr"et`
+	check_round_trip(t, b)
+}
+
+func TestWireReadsFormatZero(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "question")
+	b.playerList = "2 3 "
+	b.minorList["1"] = `s3cr"et`
+	old := `{"hash": "` + b.Header.Hash + `", "timeStamp": 1550013938, "height": 1, "parentHash": "genesis", "size": ` +
+		fmt.Sprint(b.Header.Size) + `, "version": 1, "root": "` + b.Header.Root + `", "creator": "1", "playerlist": "2 3 ", ` +
+		`"minorlist": {"1": "s3cr\"et"}, "rank": {"1": 1, "2": 0}}`
+	decoded := DecodeFromJson(old)
+	if decoded == nil {
+		t.Fatal("cannot decode a format 0 block")
+	}
+	check_block(t, b, decoded)
+}
+
+func TestWireRefusesNewerFormat(t *testing.T) {
+	use_memory_store(t)
+	b := test_block(1, "genesis", "question")
+	if DecodeFromJson(`{"format": 2, "hash": "`+b.Header.Hash+`"}`) != nil {
+		t.Fatal("decoded a block of an unknown format")
+	}
+}
@@ -0,0 +1,95 @@
+package p3
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"../p2"
+)
+
+// /export
+// Method: GET
+// Response: the chain as newline delimited JSON, see p2.NDJSON_CONTENT_TYPE, written while
+// it is read. With ?nodes=true every block carries its MPT nodes, for a backup.
+func Export(w http.ResponseWriter, r *http.Request) {
+	if !ifStarted {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Please start first"))
+		return
+	}
+	withNodes := r.URL.Query().Get("nodes") == "true"
+	w.Header().Set("Content-Type", p2.NDJSON_CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	if err := SBC.Export(w, withNodes); err != nil {
+		fmt.Println("Export: ", err)
+	}
+}
+
+// /import
+// Method: POST
+// Request: blocks as written by /export, parents before children.
+// Response: the number of blocks added. Every block is validated before it is inserted,
+// the import stops at the first bad one with HTTP 400, the blocks before it stay.
+func Import(w http.ResponseWriter, r *http.Request) {
+	if !ifStarted {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Please start first"))
+		return
+	}
+	count, err := SBC.Import(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strconv.Itoa(count) + " blocks imported, then " + err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.Itoa(count)))
+}
+
+// Backup saves the chain of the node at addr, with the tries of its blocks, to the file at path
+func Backup(addr string, path string) error {
+	response, err := http.Get(addr + "/export?nodes=true")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return errors.New("export failed with HTTP " + strconv.Itoa(response.StatusCode))
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.ReadFrom(response.Body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Restore sends the blocks of a backup made by Backup to the node at addr, it returns what
+// the node answered
+func Restore(addr string, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	response, err := http.Post(addr+"/import", p2.NDJSON_CONTENT_TYPE, file)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", errors.New(string(body))
+	}
+	return string(body), nil
+}
@@ -0,0 +1,115 @@
+package p3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"../p1"
+	"../p2"
+	"./data"
+)
+
+// test_node starts serving the handlers of this node with a chain of two blocks
+func test_node(t *testing.T) *httptest.Server {
+	// SBC holds a lock and cannot be copied aside, the node is left with an empty chain
+	old_store, old_started := p2.TrieStore, ifStarted
+	t.Cleanup(func() {
+		p2.TrieStore, ifStarted = old_store, old_started
+		SBC = data.NewBlockChain()
+	})
+	p2.TrieStore = p1.NewMemoryStore()
+	SBC = data.NewBlockChain()
+	ifStarted = true
+
+	mpt, err := data.GenMPT("question", "answer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := SBC.GenBlock(mpt, map[string]int32{"1": 1}, "1")
+	SBC.GenBlockOn(genesis, mpt, map[string]int32{"1": 2}, "1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/export", Export)
+	mux.HandleFunc("/import", Import)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// a fresh node with a store of its own, as after a restart from nothing
+func reset_node() {
+	p2.TrieStore = p1.NewMemoryStore()
+	SBC = data.NewBlockChain()
+}
+
+func TestExportImportOverHttp(t *testing.T) {
+	server := test_node(t)
+	response, err := http.Get(server.URL + "/export?nodes=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != p2.NDJSON_CONTENT_TYPE {
+		t.Fatalf("content type %q", response.Header.Get("Content-Type"))
+	}
+	head, _ := SBC.CanonicalHead()
+
+	reset_node()
+	response, err = http.Post(server.URL+"/import", p2.NDJSON_CONTENT_TYPE, response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("import answered HTTP %d", response.StatusCode)
+	}
+	restored, found := SBC.CanonicalHead()
+	if !found || restored.Header.Hash != head.Header.Hash {
+		t.Fatalf("head %s after import, want %s", restored.Header.Hash, head.Header.Hash)
+	}
+	if value, err := restored.Value.Get("content"); err != nil || value != "question" {
+		t.Fatalf("content %q, %v", value, err)
+	}
+}
+
+func TestImportRejectsOrphans(t *testing.T) {
+	server := test_node(t)
+	response, err := http.Get(server.URL + "/export?nodes=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(body), "\n")
+
+	reset_node()
+	response, err = http.Post(server.URL+"/import", p2.NDJSON_CONTENT_TYPE, strings.NewReader(lines[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest || !SBC.IsEmpty() {
+		t.Fatalf("a block without parent was imported, HTTP %d", response.StatusCode)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	server := test_node(t)
+	path := t.TempDir() + "/chain.ndjson"
+	if err := Backup(server.URL, path); err != nil {
+		t.Fatal(err)
+	}
+	reset_node()
+	if added, err := Restore(server.URL, path); err != nil || added != "2" {
+		t.Fatalf("restored %s blocks: %v", added, err)
+	}
+	if added, err := Restore(server.URL, path); err != nil || added != "0" {
+		t.Fatalf("restored %s blocks again: %v", added, err)
+	}
+}
@@ -1,7 +1,9 @@
 package data
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"sync"
 
 	"../../p1"
@@ -14,8 +16,10 @@ import (
 // But you can ask questions about the functions which you get confused.
 
 type SyncBlockChain struct {
-	bc  p2.BlockChain
-	mux sync.Mutex
+	bc     p2.BlockChain
+	mux    sync.Mutex
+	pruner *p1.Pruner
+	store  *p2.ChainStore
 }
 
 func NewBlockChain() SyncBlockChain {
@@ -33,65 +37,184 @@ func (sbc *SyncBlockChain) Get(height int32) ([]p2.Block, bool) {
 }
 
 func (sbc *SyncBlockChain) GetBlock(height int32, hash string) (p2.Block, bool) {
-	fmt.Println("Why I'm wrong?????? ")
-	fmt.Println(height)
-	blocks, valid := sbc.Get(height)
-	fmt.Println(valid)
-	emptyBlock := p2.Block{}
-	if !valid {
-		return emptyBlock, false
-	}
-	for _, v := range blocks {
-		if v.Header.Hash == hash {
-			fmt.Println("GetBlock/ Find the Block!!!")
-			return v, true
-		}
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	block, found := sbc.bc.GetBlockByHash(hash)
+	if !found || block.Header.Height != height {
+		return p2.Block{}, false
 	}
-	return emptyBlock, false
+	return block, true
+}
+
+func (sbc *SyncBlockChain) HasBlock(hash string) bool {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.HasBlock(hash)
+}
+
+// GetChildren returns the blocks built right on top of the block with this hash
+func (sbc *SyncBlockChain) GetChildren(hash string) []p2.Block {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.GetChildren(hash)
 }
 
 func (sbc *SyncBlockChain) Insert(block p2.Block) {
 	sbc.mux.Lock()
-	sbc.bc.Insert(&block)
+	sbc.insert(&block)
 	sbc.mux.Unlock()
 }
 
+// Open loads the chain kept in the log at path and records every later change in it
+func (sbc *SyncBlockChain) Open(path string) error {
+	store, blockChain, err := p2.OpenChainStore(path)
+	if err != nil {
+		return err
+	}
+	sbc.mux.Lock()
+	sbc.bc.Replace(blockChain)
+	sbc.store = store
+	sbc.mux.Unlock()
+	return nil
+}
+
+// IsEmpty tells if the chain has no block yet
+func (sbc *SyncBlockChain) IsEmpty() bool {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.Length == 0
+}
+
+// insert a block and record it in the store, the lock must be held
+func (sbc *SyncBlockChain) insert(block *p2.Block) {
+	if sbc.bc.HasBlock(block.Header.Hash) {
+		return
+	}
+	sbc.bc.Insert(block)
+	if sbc.store != nil {
+		if err := sbc.store.Append(block); err != nil {
+			fmt.Println("chain store: ", err)
+		}
+	}
+}
+
+// record a block again after it changed, the lock must be held
+func (sbc *SyncBlockChain) recordUpdate(hash string) {
+	if sbc.store == nil {
+		return
+	}
+	if block, found := sbc.bc.GetBlockByHash(hash); found {
+		if err := sbc.store.Update(&block); err != nil {
+			fmt.Println("chain store: ", err)
+		}
+	}
+}
+
+// Validate checks block against the chain, see BlockChain.Validate for what is checked
+func (sbc *SyncBlockChain) Validate(block p2.Block) error {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.Validate(&block)
+}
+
 // CheckParentHash(): Yes. This function would check if the block with the given "parentHash"
 // exists in the blockChain. If we have the parent block, we can insert the next block;
 // if we don't have the parent block, we have to download the parent block before inserting the next block.
 func (sbc *SyncBlockChain) CheckParentHash(insertBlock p2.Block) bool {
-	if insertBlock.Header.ParentHash == "genesis" {
-		return true
-	}
-	chain := sbc.bc.Chain
-	for _, blocks := range chain {
-		for _, block := range blocks {
-			if block.Header.Hash == insertBlock.Header.ParentHash {
-				return true
-			}
-		}
-	}
-	return false
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return !sbc.bc.IsOrphan(&insertBlock)
 }
 
-//????
+// UpdateEntireBlockChain replaces the chain with the one in blockChainJson. The chain is
+// decoded without the lock like in Import, its tries may be fetched from the peers.
 func (sbc *SyncBlockChain) UpdateEntireBlockChain(blockChainJson string) {
-	sbc.mux.Lock()
 	blockChain, err := p2.DecodeJsonToBlockChain(blockChainJson)
 	if err != nil {
 		fmt.Println("Some error in decode")
-		sbc.mux.Unlock()
 		return
 	}
 
-	sbc.bc = *blockChain
+	sbc.mux.Lock()
+	sbc.replace(blockChain)
 	sbc.mux.Unlock()
 }
 
+// UpdateEntireBlockChainBinary is UpdateEntireBlockChain for a binary block stream
+func (sbc *SyncBlockChain) UpdateEntireBlockChainBinary(data []byte) error {
+	blockChain, err := p2.DecodeBinaryToBlockChain(data)
+	if err != nil {
+		return err
+	}
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	sbc.replace(blockChain)
+	return nil
+}
+
+// replace the blocks and rewrite the store with them, the lock must be held
+func (sbc *SyncBlockChain) replace(blockChain *p2.BlockChain) {
+	sbc.bc.Replace(blockChain)
+	if sbc.store != nil {
+		if err := sbc.store.Replace(&sbc.bc); err != nil {
+			fmt.Println("chain store: ", err)
+		}
+	}
+}
+
 func (sbc *SyncBlockChain) BlockChainToJson() (string, error) {
 	return sbc.bc.EncodeToJson()
 }
 
+// BlockChainToBinary encodes the chain as a binary block stream
+func (sbc *SyncBlockChain) BlockChainToBinary() ([]byte, error) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.EncodeToBinary()
+}
+
+// Export streams the chain to w, see p2.NDJSON_CONTENT_TYPE. The lock is taken for one
+// block at a time, the chain keeps working while a slow reader is being served.
+func (sbc *SyncBlockChain) Export(w io.Writer, withNodes bool) error {
+	sbc.mux.Lock()
+	hashes := sbc.bc.Hashes()
+	sbc.mux.Unlock()
+	buf := bytes.Buffer{}
+	writer := p2.NewJsonBlockWriter(&buf, withNodes)
+	for _, hash := range hashes {
+		var err error
+		sbc.mux.Lock()
+		if block, found := sbc.bc.GetBlockByHash(hash); found {
+			err = writer.Write(&block)
+		}
+		sbc.mux.Unlock()
+		if err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import reads a stream written by Export and validates and inserts its blocks one by one,
+// see p2.ImportBlocks. Blocks are decoded without the lock, their tries may be fetched.
+func (sbc *SyncBlockChain) Import(r io.Reader) (int, error) {
+	return p2.ImportBlocks(r, func(block *p2.Block) (bool, error) {
+		sbc.mux.Lock()
+		defer sbc.mux.Unlock()
+		if sbc.bc.HasBlock(block.Header.Hash) {
+			return false, nil
+		}
+		if err := sbc.bc.Validate(block); err != nil {
+			return false, err
+		}
+		sbc.insert(block)
+		return true, nil
+	})
+}
+
 // This function generates a new block after the current highest block.
 // You may consider it "create the next block".
 // For example, suppose we have blocks of height 1~5.
@@ -99,23 +222,34 @@ func (sbc *SyncBlockChain) BlockChainToJson() (string, error) {
 func (sbc *SyncBlockChain) GenBlock(mpt p1.MerklePatriciaTrie, rank map[string]int32, creatorId string) p2.Block {
 	len := sbc.bc.Length
 	fmt.Println("SBC length", len)
+	parent := p2.Block{}
 	parentHash := "genesis"
 	if len > 0 {
 		highestBlock := sbc.bc.Chain[len]
-		parentHash = highestBlock[0].Header.Hash
+		parent = highestBlock[0]
+		parentHash = parent.Header.Hash
 	}
 	// NewBlock(height int32, timeStamp int64, parentHash string, mpt p1.MerklePatriciaTrie,
 	// 	rank map[string]int32, creator string, playerlist string, minorlist string)
 
 	minorlist := map[string]string{}
-	newBlock := p2.NewBlock(len+1, 1234567890, parentHash, mpt, rank, creatorId, "", minorlist)
+	newBlock := p2.NewBlock(len+1, p2.NextTimeStamp(parent), parentHash, mpt, rank, creatorId, "", minorlist)
 
-	sbc.bc.Insert(newBlock)
+	sbc.insert(newBlock)
 	fmt.Println(newBlock)
 
 	return *newBlock
 }
 
+// GenBlockOn generates a new block right after parent, which does not have to be the highest block
+func (sbc *SyncBlockChain) GenBlockOn(parent p2.Block, mpt p1.MerklePatriciaTrie, rank map[string]int32, creatorId string) p2.Block {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	newBlock := p2.NewBlock(parent.Header.Height+1, p2.NextTimeStamp(parent), parent.Header.Hash, mpt, rank, creatorId, "", map[string]string{})
+	sbc.insert(newBlock)
+	return *newBlock
+}
+
 func (sbc *SyncBlockChain) Show() string {
 	return sbc.bc.Show()
 }
@@ -145,22 +279,64 @@ func (sbc *SyncBlockChain) GetBlocks(height int32) []p2.Block {
 func (sbc *SyncBlockChain) AddCreator(id string, secret string, block p2.Block) {
 	sbc.mux.Lock()
 	sbc.bc.AddCreator(id, secret, block.Header.Height, block.Header.Hash)
+	sbc.recordUpdate(block.Header.Hash)
 	sbc.mux.Unlock()
 }
 
 func (sbc *SyncBlockChain) AddPlayer(id string, block p2.Block) {
 	sbc.mux.Lock()
 	sbc.bc.AddPlayer(id, block.Header.Height, block.Header.Hash)
+	sbc.recordUpdate(block.Header.Hash)
 	sbc.mux.Unlock()
 }
 
 func (sbc *SyncBlockChain) UpdateBlock(block p2.Block, creator string) bool {
 	sbc.mux.Lock()
 	res := sbc.bc.UpdateBlock(block, creator)
+	if res {
+		sbc.recordUpdate(block.Header.Hash)
+	}
 	sbc.mux.Unlock()
 	return res
 }
 
+func (sbc *SyncBlockChain) CanonicalHead() (p2.Block, bool) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.CanonicalHead()
+}
+
+func (sbc *SyncBlockChain) IsCanonical(hash string) bool {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	return sbc.bc.IsCanonical(hash)
+}
+
+func (sbc *SyncBlockChain) SetForkRule(rule p2.ForkRule) {
+	sbc.mux.Lock()
+	sbc.bc.SetForkRule(rule)
+	sbc.mux.Unlock()
+}
+
+// OnReorg registers fn for head changes, fn runs with the lock held and must not use sbc
+func (sbc *SyncBlockChain) OnReorg(fn func(event p2.ReorgEvent)) {
+	sbc.mux.Lock()
+	sbc.bc.OnReorg(fn)
+	sbc.mux.Unlock()
+}
+
+// PruneTries drops the MPT nodes no block uses anymore. A trie built since the previous
+// run but not inserted yet is kept, see p1.Pruner. The tries of retain are kept as well,
+// e.g. the ones of the blocks waiting in the orphan pool.
+func (sbc *SyncBlockChain) PruneTries(retain ...string) (p1.PruneStats, error) {
+	sbc.mux.Lock()
+	defer sbc.mux.Unlock()
+	if sbc.pruner == nil {
+		sbc.pruner = p1.NewPruner(p2.TrieStore)
+	}
+	return sbc.pruner.Prune(append(sbc.bc.Roots(), retain...)...)
+}
+
 func (sbc *SyncBlockChain) GetOverview(id string) string {
 	fmt.Println("LALLA")
 	return sbc.bc.GetOverview(id)
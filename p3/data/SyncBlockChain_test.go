@@ -0,0 +1,80 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"../../p2"
+)
+
+// use_fake_clock stamps and checks blocks with a clock the test moves
+func use_fake_clock(t *testing.T, now time.Time) *p2.FakeClock {
+	old := p2.BlockClock
+	clock := p2.NewFakeClock(now)
+	p2.BlockClock = clock
+	t.Cleanup(func() { p2.BlockClock = old })
+	return clock
+}
+
+func TestGenBlockTimestamp(t *testing.T) {
+	clock := use_fake_clock(t, time.Unix(1550013937, 0))
+	sbc := NewBlockChain()
+	store := p2.TrieStore
+	genesis := sbc.GenBlock(trie_of(store, "question", "genesis"), map[string]int32{"1": 1}, "1")
+	if genesis.Header.TimeStamp != 1550013937 {
+		t.Fatalf("genesis stamped %d", genesis.Header.TimeStamp)
+	}
+	clock.Advance(10 * time.Second)
+	next := sbc.GenBlock(trie_of(store, "question", "next"), map[string]int32{"1": 2}, "1")
+	if next.Header.TimeStamp != 1550013947 {
+		t.Fatalf("second block stamped %d", next.Header.TimeStamp)
+	}
+	clock.Advance(time.Minute)
+	fork := sbc.GenBlockOn(genesis, trie_of(store, "question", "fork"), map[string]int32{"1": 2}, "1")
+	if fork.Header.TimeStamp != 1550014007 || fork.Header.ParentHash != genesis.Header.Hash {
+		t.Fatalf("fork stamped %d on %s", fork.Header.TimeStamp, fork.Header.ParentHash)
+	}
+	// a clock behind the parent's does not stamp a block before its parent
+	clock.Set(time.Unix(1550013900, 0))
+	late := sbc.GenBlockOn(fork, trie_of(store, "question", "late"), map[string]int32{"1": 3}, "1")
+	if late.Header.TimeStamp != fork.Header.TimeStamp {
+		t.Fatalf("block stamped %d after a parent stamped %d", late.Header.TimeStamp, fork.Header.TimeStamp)
+	}
+}
+
+// blocks dropped by downloading a whole chain must not come back from the log
+func TestReplaceKeepsDroppedBlocksDropped(t *testing.T) {
+	path := t.TempDir() + "/chain.log"
+	sbc := NewBlockChain()
+	if err := sbc.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	store := p2.TrieStore
+	genesis := sbc.GenBlock(trie_of(store, "question", "genesis"), map[string]int32{"1": 1}, "1")
+	dropped := sbc.GenBlock(trie_of(store, "question", "dropped"), map[string]int32{"1": 2}, "1")
+
+	other := NewBlockChain()
+	other.Insert(genesis)
+	kept := other.GenBlockOn(genesis, trie_of(store, "question", "kept"), map[string]int32{"1": 2}, "1")
+	encoded, err := other.BlockChainToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		sbc.UpdateEntireBlockChain(encoded)
+	}
+	if sbc.HasBlock(dropped.Header.Hash) || !sbc.HasBlock(kept.Header.Hash) {
+		t.Fatal("the chain was not replaced")
+	}
+
+	reopened := NewBlockChain()
+	if err := reopened.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.HasBlock(dropped.Header.Hash) {
+		t.Fatal("a dropped block came back from the log")
+	}
+	if !reopened.HasBlock(genesis.Header.Hash) || !reopened.HasBlock(kept.Header.Hash) {
+		t.Fatal("blocks of the downloaded chain are missing from the log")
+	}
+}
@@ -1,10 +1,33 @@
 package data
 
 type CreateData struct {
-	Id           string `json:"id"`
-	ParentHeight int32  `json:"parentHeight"`
-	ParentHash   string `json:"parentHash"`
-	Content      string `json:"hash"`
-	React        string `json:"react"`
-	Secret       string `json:"secret"`
+	Id           string    `json:"id"`
+	ParentHeight int32     `json:"parentHeight"`
+	ParentHash   string    `json:"parentHash"`
+	Content      string    `json:"hash"`
+	React        string    `json:"react"`
+	Secret       string    `json:"secret"`
+	Question     *Question `json:"question,omitempty"`
+}
+
+// Question is a game question as a typed value. Blocks keep it under "question",
+// next to the plain "content" and "react" strings older nodes read.
+type Question struct {
+	Text    string   `json:"text"`
+	Choices []string `json:"choices,omitempty"`
+	Hints   []string `json:"hints,omitempty"`
+	Media   []string `json:"media,omitempty"`
+	Answer  string   `json:"answer"`
+}
+
+// Content is the question as the text players see, choices lettered A), B), ...
+func (q Question) Content() string {
+	if len(q.Choices) == 0 {
+		return q.Text
+	}
+	content := q.Text + "\n"
+	for i, choice := range q.Choices {
+		content += string(rune('A'+i)) + ") " + choice + "\n"
+	}
+	return content
 }
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 
 	"../../p1"
+	"../../p2"
 )
 
 // PeerMap maps IP Address to its ID. PeerList is a struct containing PeerMap.
@@ -74,17 +75,36 @@ func PrepareHeartBeatData(sbc *SyncBlockChain, id string, nodeId int32, peerMapB
 }
 
 //generate a random MPT
-func GenMPT(content string, react string) p1.MerklePatriciaTrie {
+func GenMPT(content string, react string) (p1.MerklePatriciaTrie, error) {
 	mpt := p1.MerklePatriciaTrie{}
-	mpt.Initial()
+	mpt.InitialWithStore(p2.TrieStore)
 	i := rand.Intn(5)
+	batch := mpt.NewBatch()
 	if content == "" {
-		mpt.Insert("content", MPT_Q[i])
-		mpt.Insert("react", MPT_A[i])
+		batch.Put("content", MPT_Q[i])
+		batch.Put("react", MPT_A[i])
 	} else {
-		mpt.Insert("content", content)
-		mpt.Insert("react", react)
+		batch.Put("content", content)
+		batch.Put("react", react)
 	}
+	_, err := batch.Commit()
+	return mpt, err
+}
 
-	return mpt
+// GenQuestionMPT stores question both typed and as plain content and react,
+// a question without text gets a random one like GenMPT
+func GenQuestionMPT(question Question) (p1.MerklePatriciaTrie, error) {
+	if question.Text == "" {
+		return GenMPT("", "")
+	}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(p2.TrieStore)
+	batch := mpt.NewBatch()
+	batch.Put("content", question.Content())
+	batch.Put("react", question.Answer)
+	if err := batch.PutValue("question", question); err != nil {
+		return mpt, err
+	}
+	_, err := batch.Commit()
+	return mpt, err
 }
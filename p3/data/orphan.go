@@ -0,0 +1,144 @@
+package data
+
+import (
+	"sync"
+	"time"
+
+	"../../p2"
+)
+
+// Orphan is a block that came before its parent. CreatorId and Secret are the ones of the
+// heartbeat that brought it, empty for an ancestor fetched from a peer.
+type Orphan struct {
+	Block     p2.Block
+	CreatorId string
+	Secret    string
+	received  time.Time
+}
+
+// OrphanPool keeps orphan blocks until their parent is in the chain. It holds at most
+// maxSize blocks, the oldest go first, and none older than maxAge.
+type OrphanPool struct {
+	orphans  map[string]*Orphan
+	byParent map[string][]string
+	maxSize  int
+	maxAge   time.Duration
+	mux      sync.Mutex
+}
+
+func NewOrphanPool(maxSize int, maxAge time.Duration) OrphanPool {
+	return OrphanPool{orphans: map[string]*Orphan{}, byParent: map[string][]string{}, maxSize: maxSize, maxAge: maxAge}
+}
+
+// Add keeps orphan, it returns false if the pool already had it
+func (pool *OrphanPool) Add(orphan Orphan) bool {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	hash := orphan.Block.Header.Hash
+	if _, ok := pool.orphans[hash]; ok {
+		return false
+	}
+	pool.expire()
+	for len(pool.orphans) >= pool.maxSize && len(pool.orphans) > 0 {
+		pool.remove(pool.oldest())
+	}
+	orphan.received = p2.BlockClock.Now()
+	pool.orphans[hash] = &orphan
+	parent := orphan.Block.Header.ParentHash
+	pool.byParent[parent] = append(pool.byParent[parent], hash)
+	return true
+}
+
+// TakeChildren removes and returns the orphans whose parent is parentHash
+func (pool *OrphanPool) TakeChildren(parentHash string) []Orphan {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	ret := []Orphan{}
+	for _, hash := range pool.byParent[parentHash] {
+		if orphan, ok := pool.orphans[hash]; ok {
+			ret = append(ret, *orphan)
+			pool.remove(hash)
+		}
+	}
+	return ret
+}
+
+// Missing returns the hash and height of every block the pool waits for:
+// the parents of the orphans that are not orphans themselves
+func (pool *OrphanPool) Missing() map[string]int32 {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	ret := map[string]int32{}
+	for _, orphan := range pool.orphans {
+		parent := orphan.Block.Header.ParentHash
+		if _, ok := pool.orphans[parent]; !ok && parent != "genesis" {
+			ret[parent] = orphan.Block.Header.Height - 1
+		}
+	}
+	return ret
+}
+
+// Roots returns the MPT roots of the orphans, their tries must survive pruning until
+// the orphans can be inserted
+func (pool *OrphanPool) Roots() []string {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	roots := []string{}
+	for _, orphan := range pool.orphans {
+		roots = append(roots, orphan.Block.Value.Get_root())
+	}
+	return roots
+}
+
+// Expire drops the orphans older than the age limit
+func (pool *OrphanPool) Expire() {
+	pool.mux.Lock()
+	pool.expire()
+	pool.mux.Unlock()
+}
+
+func (pool *OrphanPool) Len() int {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	return len(pool.orphans)
+}
+
+func (pool *OrphanPool) expire() {
+	now := p2.BlockClock.Now()
+	for hash, orphan := range pool.orphans {
+		if now.Sub(orphan.received) > pool.maxAge {
+			pool.remove(hash)
+		}
+	}
+}
+
+func (pool *OrphanPool) oldest() string {
+	oldest := ""
+	for hash, orphan := range pool.orphans {
+		if oldest == "" || orphan.received.Before(pool.orphans[oldest].received) {
+			oldest = hash
+		}
+	}
+	return oldest
+}
+
+func (pool *OrphanPool) remove(hash string) {
+	orphan, ok := pool.orphans[hash]
+	if !ok {
+		return
+	}
+	delete(pool.orphans, hash)
+	parent := orphan.Block.Header.ParentHash
+	siblings := pool.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(pool.byParent, parent)
+	} else {
+		pool.byParent[parent] = siblings
+	}
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"../../p1"
+	"../../p2"
+)
+
+func trie_of(store p1.NodeStore, key string, value string) p1.MerklePatriciaTrie {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert(key, value)
+	return mpt
+}
+
+// the trie of a block waiting in the pool must survive pruning until its parent comes
+func TestPruneKeepsOrphanTries(t *testing.T) {
+	store := p1.NewMemoryStore()
+	old := p2.TrieStore
+	p2.TrieStore = store
+	defer func() { p2.TrieStore = old }()
+
+	sbc := NewBlockChain()
+	genesis := sbc.GenBlock(trie_of(store, "question", "genesis"), map[string]int32{"1": 1}, "1")
+	parent := p2.NewBlock(2, genesis.Header.TimeStamp+1, genesis.Header.Hash, trie_of(store, "question", "parent"),
+		map[string]int32{"1": 2}, "1", "", map[string]string{})
+	orphan := p2.NewBlock(3, genesis.Header.TimeStamp+2, parent.Header.Hash, trie_of(store, "question", "orphan"),
+		map[string]int32{"1": 3}, "1", "", map[string]string{})
+	parent_root := parent.Value.Get_root()
+
+	pool := NewOrphanPool(8, time.Hour)
+	pool.Add(Orphan{Block: *orphan})
+	for i := 0; i < 3; i++ {
+		if _, err := sbc.PruneTries(pool.Roots()...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.Get(parent_root); ok {
+		t.Fatalf("the trie of a block nobody holds was kept")
+	}
+
+	// the parent arrives with its trie
+	parent = p2.NewBlock(2, genesis.Header.TimeStamp+1, genesis.Header.Hash, trie_of(store, "question", "parent"),
+		map[string]int32{"1": 2}, "1", "", map[string]string{})
+	if err := sbc.Validate(*parent); err != nil {
+		t.Fatal(err)
+	}
+	sbc.Insert(*parent)
+	for _, child := range pool.TakeChildren(parent.Header.Hash) {
+		if err := sbc.Validate(child.Block); err != nil {
+			t.Fatalf("orphan rejected after pruning: %v", err)
+		}
+	}
+}
+
+// a block of height on top of parentHash, the orphans of these tests never get validated
+func orphan_block(height int32, parentHash string, question string) p2.Block {
+	block := p2.NewBlock(height, 1550013937+int64(height), parentHash, trie_of(p2.TrieStore, "question", question),
+		map[string]int32{"1": height}, "1", "", map[string]string{})
+	return *block
+}
+
+func TestOrphanPoolTakeChildren(t *testing.T) {
+	use_fake_clock(t, time.Unix(1550013937, 0))
+	pool := NewOrphanPool(8, time.Hour)
+	a := orphan_block(5, "parent", "a")
+	b := orphan_block(5, "parent", "b")
+	c := orphan_block(6, a.Header.Hash, "c")
+	for _, block := range []p2.Block{a, b, c} {
+		if !pool.Add(Orphan{Block: block, CreatorId: "1"}) {
+			t.Fatalf("orphan %s not added", block.Header.Hash)
+		}
+	}
+	if pool.Add(Orphan{Block: a}) || pool.Len() != 3 {
+		t.Fatalf("an orphan was added twice, %d in the pool", pool.Len())
+	}
+	missing := pool.Missing()
+	if len(missing) != 1 || missing["parent"] != 4 {
+		t.Fatalf("missing %v, want the parent at height 4", missing)
+	}
+
+	children := pool.TakeChildren("parent")
+	if len(children) != 2 || children[0].CreatorId != "1" {
+		t.Fatalf("took %d children", len(children))
+	}
+	if len(pool.TakeChildren("parent")) != 0 || pool.Len() != 1 {
+		t.Fatalf("children taken twice, %d in the pool", pool.Len())
+	}
+	missing = pool.Missing()
+	if len(missing) != 1 || missing[a.Header.Hash] != 5 {
+		t.Fatalf("missing %v, want %s at height 5", missing, a.Header.Hash)
+	}
+	if grandchildren := pool.TakeChildren(a.Header.Hash); len(grandchildren) != 1 || grandchildren[0].Block.Header.Hash != c.Header.Hash {
+		t.Fatalf("took %d grandchildren", len(grandchildren))
+	}
+	if pool.Len() != 0 || len(pool.Missing()) != 0 {
+		t.Fatalf("%d orphans left", pool.Len())
+	}
+}
+
+func TestOrphanPoolEvictsOldestWhenFull(t *testing.T) {
+	clock := use_fake_clock(t, time.Unix(1550013937, 0))
+	pool := NewOrphanPool(2, time.Hour)
+	blocks := []p2.Block{}
+	for i, question := range []string{"first", "second", "third"} {
+		block := orphan_block(int32(i+2), "parent "+question, question)
+		blocks = append(blocks, block)
+		pool.Add(Orphan{Block: block})
+		clock.Advance(time.Second)
+	}
+	if pool.Len() != 2 {
+		t.Fatalf("%d orphans in a pool of 2", pool.Len())
+	}
+	missing := pool.Missing()
+	if _, ok := missing[blocks[0].Header.ParentHash]; ok {
+		t.Fatal("the oldest orphan was kept")
+	}
+	for _, block := range blocks[1:] {
+		if _, ok := missing[block.Header.ParentHash]; !ok {
+			t.Fatalf("orphan %s was evicted", block.Header.Hash)
+		}
+	}
+}
+
+func TestOrphanPoolExpires(t *testing.T) {
+	clock := use_fake_clock(t, time.Unix(1550013937, 0))
+	pool := NewOrphanPool(8, time.Minute)
+	old := orphan_block(2, "old parent", "old")
+	pool.Add(Orphan{Block: old})
+	clock.Advance(40 * time.Second)
+	young := orphan_block(2, "young parent", "young")
+	pool.Add(Orphan{Block: young})
+
+	clock.Advance(30 * time.Second)
+	pool.Expire()
+	if pool.Len() != 1 || len(pool.TakeChildren("young parent")) != 1 {
+		t.Fatalf("%d orphans after the first one expired", pool.Len())
+	}
+
+	// adding expires too
+	pool.Add(Orphan{Block: old})
+	clock.Advance(2 * time.Minute)
+	pool.Add(Orphan{Block: young})
+	if pool.Len() != 1 || len(pool.TakeChildren("old parent")) != 0 {
+		t.Fatalf("an expired orphan was kept, %d in the pool", pool.Len())
+	}
+}
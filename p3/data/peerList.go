@@ -111,7 +111,7 @@ func (peers *PeerList) Show() string {
 	for k, v := range peers.peerMap {
 		ret = ret + "addr=" + k + ", id=" + string(v) + "\n"
 	}
-	fmt.Printf(ret)
+	fmt.Print(ret)
 	return ret
 }
 
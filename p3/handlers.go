@@ -3,15 +3,19 @@ package p3
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"../p1"
 	"../p2"
 	"./data"
 	"github.com/gorilla/mux"
@@ -22,6 +26,27 @@ var REGISTER_SERVER = TA_SERVER + "/peer"
 var BC_DOWNLOAD_SERVER = TA_SERVER + "/upload"
 var SELF_ADDR = "http://localhost:6680"
 
+// file to keep the MPT nodes of all blocks in, empty means memory only, see UseDataDir
+var MPT_STORE_PATH = ""
+
+// file to keep the blocks in, empty means memory only, see UseDataDir
+var CHAIN_STORE_PATH = ""
+
+// set when Init found blocks in CHAIN_STORE_PATH, the chain is not downloaded again
+var restored bool
+
+// how the canonical chain is picked among forks
+var FORK_RULE = p2.LongestChain
+
+// blocks received before their parent, see ReceiveBlock
+var ORPHANS data.OrphanPool
+var ORPHAN_POOL_SIZE = 256
+var ORPHAN_MAX_AGE = 10 * time.Minute
+var ORPHAN_FETCH_INTERVAL = 3 * time.Second
+
+// how long a peer gets to answer for one MPT node, see AskForNode
+var NODE_FETCH_TIMEOUT = 5 * time.Second
+
 var ID int32 = 123
 var SBC data.SyncBlockChain
 var Peers data.PeerList
@@ -30,16 +55,57 @@ var Hex = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "
 
 // ssh -L 6688:mc07.cs.usfca.edu:6688 <username>@stargate.cs.usfca.ed
 
+// UseDataDir keeps the MPT nodes and the blocks in files under dir, so a restarted node
+// comes back with its chain instead of downloading it again. An empty dir keeps them in
+// memory. It must be called before Start.
+func UseDataDir(dir string) error {
+	if dir == "" {
+		MPT_STORE_PATH, CHAIN_STORE_PATH = "", ""
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	MPT_STORE_PATH = filepath.Join(dir, "mpt.log")
+	CHAIN_STORE_PATH = filepath.Join(dir, "chain.log")
+	return nil
+}
+
 // Init():
 // Create SyncBlockChain and PeerList instances.
 func Init() {
 	// This function will be executed before everything else.
 	// Do some initialization here.
 	fmt.Println("Initing")
+	if MPT_STORE_PATH != "" {
+		store, err := p1.NewFileStore(MPT_STORE_PATH)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p2.TrieStore = store
+	}
 	SBC = data.NewBlockChain()
+	SBC.SetForkRule(FORK_RULE)
+	SBC.OnReorg(func(event p2.ReorgEvent) {
+		if len(event.Dropped) != 0 {
+			fmt.Println("REORG/ head ", event.OldHead, " -> ", event.NewHead, ", dropped ", len(event.Dropped), " blocks")
+		}
+	})
+	if CHAIN_STORE_PATH != "" {
+		// replayed before FetchNode is set, a restart must not depend on the peers
+		if err := SBC.Open(CHAIN_STORE_PATH); err != nil {
+			log.Fatal(err)
+		}
+		restored = !SBC.IsEmpty()
+	}
+	p2.FetchNode = AskForNode
 	Peers = data.NewPeerList(0, 32)
-	if ID == 123 {
-		mpt := data.GenMPT("I want to start", "OK")
+	ORPHANS = data.NewOrphanPool(ORPHAN_POOL_SIZE, ORPHAN_MAX_AGE)
+	if ID == 123 && !restored {
+		mpt, err := data.GenMPT("I want to start", "OK")
+		if err != nil {
+			log.Fatal(err)
+		}
 		rank := make(map[string]int32)
 		rank["123"] = 1
 		SBC.GenBlock(mpt, rank, "123")
@@ -59,10 +125,14 @@ func Start(w http.ResponseWriter, r *http.Request) {
 
 		Register()
 
-		Download()
+		if !restored {
+			Download()
+		}
 
 		go StartHeartBeat()
 
+		go StartOrphanFetch()
+
 		ifStarted = true
 	}
 }
@@ -121,6 +191,7 @@ func Download() {
 
 	req, err := http.NewRequest("POST", BC_DOWNLOAD_SERVER, bytes.NewBuffer(jsonObj))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", p2.NDJSON_CONTENT_TYPE+", "+p2.BINARY_CONTENT_TYPE+", "+p2.JSON_CONTENT_TYPE)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 
@@ -128,6 +199,16 @@ func Download() {
 		fmt.Println("err in GET TA server")
 		return
 	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), p2.NDJSON_CONTENT_TYPE) {
+		count, err := SBC.Import(resp.Body)
+		fmt.Println("GET BODY: ", count, " blocks")
+		if err != nil {
+			fmt.Println("Some error in import: ", err)
+		}
+		return
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -135,12 +216,31 @@ func Download() {
 		return
 	}
 
+	if isBinary(resp.Header) {
+		fmt.Println("GET BODY: ", len(body), " bytes")
+		if err := SBC.UpdateEntireBlockChainBinary(body); err != nil {
+			fmt.Println("Some error in decode: ", err)
+		}
+		return
+	}
 	fmt.Println("GET BODY: " + string(body))
 	SBC.UpdateEntireBlockChain(string(body))
 }
 
+// wantsBinary tells if the caller accepts binary blocks, see p2.BINARY_CONTENT_TYPE
+func wantsBinary(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), p2.BINARY_CONTENT_TYPE)
+}
+
+// isBinary tells if a reply holds binary blocks, anything else is read as JSON
+func isBinary(header http.Header) bool {
+	return strings.HasPrefix(header.Get("Content-Type"), p2.BINARY_CONTENT_TYPE)
+}
+
 // Upload():
 // Return the BlockChain's JSON. And add the remote peer into the PeerMap.
+// A caller that accepts p2.NDJSON_CONTENT_TYPE gets the blocks streamed one per line,
+// one that accepts p2.BINARY_CONTENT_TYPE gets a binary block stream.
 func Upload(w http.ResponseWriter, r *http.Request) {
 	//add the remote's id and addr
 	fmt.Println("Upload")
@@ -164,6 +264,29 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	}
 	Peers.Add(peer.Addr, peer.Id)
 
+	if strings.Contains(r.Header.Get("Accept"), p2.NDJSON_CONTENT_TYPE) {
+		w.Header().Set("Content-Type", p2.NDJSON_CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		if err := SBC.Export(w, false); err != nil {
+			data.PrintError(err, "Upload")
+		}
+		return
+	}
+
+	if wantsBinary(r) {
+		blockChain, err := SBC.BlockChainToBinary()
+		if err != nil {
+			data.PrintError(err, "Upload")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error when get block chain"))
+			return
+		}
+		w.Header().Set("Content-Type", p2.BINARY_CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		w.Write(blockChain)
+		return
+	}
+
 	//return the blockchain's json
 	blockChainJson, err := SBC.BlockChainToJson()
 	if err != nil {
@@ -173,13 +296,15 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", p2.JSON_CONTENT_TYPE)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(blockChainJson))
 }
 
 // /block/{height}/{hash}
 // Method: GET
-// Response: If you have the block, return the JSON string of the specific block;
+// Response: If you have the block, return the JSON string of the specific block,
+// or its binary encoding if the caller accepts p2.BINARY_CONTENT_TYPE;
 // if you don't have the block, return HTTP 204: StatusNoContent;
 // if there's an error, return HTTP 500: InternalServerError.
 // Description: Return JSON string of a specific block to the downloader.
@@ -211,10 +336,39 @@ func UploadBlock(w http.ResponseWriter, r *http.Request) {
 
 	// fmt.Fprintf(w, "%s\n%s", Peers.Show(), SBC.Show())
 
+	if wantsBinary(r) {
+		w.Header().Set("Content-Type", p2.BINARY_CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		w.Write(block.EncodeToBinary())
+		return
+	}
+	w.Header().Set("Content-Type", p2.JSON_CONTENT_TYPE)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(block.EncodeToJson()))
 }
 
+// /node/{hash}
+// Method: GET
+// Response: the encoding of the MPT node with that hash, HTTP 204 if the node is not here.
+// Description: lets a peer fetch the trie of a block node by node from its root,
+// the peer checks the hash of every node it gets.
+func UploadNode(w http.ResponseWriter, r *http.Request) {
+	if !ifStarted {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Please start first"))
+		return
+	}
+	hash := mux.Vars(r)["hash"]
+	node, ok := p2.TrieStore.Get(hash)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(node.Encode())
+}
+
 // HeartBeatReceive(): Alter this function so that when it receives a HeartBeatData with a new block,
 // it verifies the nonce as described above. TODO
 func HeartBeatReceive(w http.ResponseWriter, r *http.Request) {
@@ -251,40 +405,35 @@ func HeartBeatReceive(w http.ResponseWriter, r *http.Request) {
 	//TODO!!!!!!!!!!!!!!
 	if heartBeatData.IfNewBlock || heartBeatData.IfUpdateBlock {
 		block := p2.DecodeFromJson(heartBeatData.BlockJson)
-		found := SBC.CheckParentHash(*block)
-		if !found {
-			// 3. If the previous block doesn't exist, the node will ask every peer
-			// at "/block/{height}/{hash}" to download that block.
-			// 4. After making sure previous block exists, insert the block from HeartBeatData to the current BlockChain.
-			parentStr := AskForBlock(block.Header.Height-1, block.Header.ParentHash)
-			if len(parentStr) == 0 {
-				fmt.Println("FORWARD/ cannot find one of the parent block")
+		if block == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("block is not valid"))
+			return
+		}
+		if err := block.Verify(); err != nil {
+			fmt.Println("FORWARD/ block cannot be verified: ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("block hash cannot be verified"))
+			return
+		}
+		if heartBeatData.IfNewBlock {
+			// 3. If the previous block doesn't exist, the block waits in the orphan pool
+			// while its ancestors are fetched from "/block/{height}/{hash}" in the background.
+			// 4. Once its parent is in the chain, it is inserted with every orphan waiting for it.
+			err := ReceiveBlock(data.Orphan{Block: *block, CreatorId: heartBeatData.CreatorId, Secret: heartBeatData.Secret})
+			if err != nil {
+				fmt.Println("FORWARD/ block rejected: ", err)
 				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("cannot find the parent block"))
+				w.Write([]byte("block rejected: " + err.Error()))
 				return
-			} else {
-				found = true
 			}
 		} else {
-			if heartBeatData.IfNewBlock {
-				parentBlock := SBC.GetParentBlock(*block)
-				if parentBlock.VerifySecret(heartBeatData.CreatorId, heartBeatData.Secret) {
-					SBC.Insert(*block)
-					fmt.Println("FORWARD/ new block inserted: ", block)
-				} else {
-					fmt.Println("verification failed")
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("verification failed cannot insert"))
-					return
-				}
-			} else {
-				success := SBC.UpdateBlock(*block, heartBeatData.CreatorId)
-				if !success {
-					fmt.Println("verification failed")
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("verification failed cannot update"))
-					return
-				}
+			success := SBC.UpdateBlock(*block, heartBeatData.CreatorId)
+			if !success {
+				fmt.Println("verification failed")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("verification failed cannot update"))
+				return
 			}
 		}
 	}
@@ -302,54 +451,178 @@ func HeartBeatReceive(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("200 OK"))
 }
 
-// AskForBlock will be called in HeartBeatReceive,
+// ReceiveBlock inserts a new block, or keeps it in the orphan pool when its parent is
+// not in the chain yet. Inserting a block also inserts the orphans waiting for it.
+func ReceiveBlock(orphan data.Orphan) error {
+	if !SBC.CheckParentHash(orphan.Block) {
+		if ORPHANS.Add(orphan) {
+			fmt.Println("FORWARD/ orphan block kept: ", orphan.Block.Header.Hash)
+		}
+		return nil
+	}
+	if err := acceptBlock(orphan); err != nil {
+		return err
+	}
+	attachOrphans(orphan.Block.Header.Hash)
+	return nil
+}
+
+// acceptBlock checks the creator's secret against the parent, when the block came with
+// one, then validates and inserts the block
+func acceptBlock(orphan data.Orphan) error {
+	if orphan.CreatorId != "" {
+		parentBlock := SBC.GetParentBlock(orphan.Block)
+		if !parentBlock.VerifySecret(orphan.CreatorId, orphan.Secret) {
+			return errors.New("verification failed cannot insert")
+		}
+	}
+	if err := SBC.Validate(orphan.Block); err != nil {
+		return err
+	}
+	SBC.Insert(orphan.Block)
+	fmt.Println("FORWARD/ new block inserted: ", orphan.Block.Header.Hash)
+	return nil
+}
+
+// attachOrphans inserts the orphans that wait for the block with this hash, and the ones
+// waiting for those, breadth first. An orphan that is not valid is dropped with its subtree.
+func attachOrphans(hash string) {
+	queue := []string{hash}
+	for len(queue) != 0 {
+		parentHash := queue[0]
+		queue = queue[1:]
+		for _, orphan := range ORPHANS.TakeChildren(parentHash) {
+			if err := acceptBlock(orphan); err != nil {
+				fmt.Println("FORWARD/ orphan block rejected: ", err)
+				dropOrphans(orphan.Block.Header.Hash)
+				continue
+			}
+			queue = append(queue, orphan.Block.Header.Hash)
+		}
+	}
+}
+
+// dropOrphans removes the orphans built on the block with this hash, which will never be
+// inserted, and the ones built on those
+func dropOrphans(hash string) {
+	queue := []string{hash}
+	for len(queue) != 0 {
+		for _, orphan := range ORPHANS.TakeChildren(queue[0]) {
+			queue = append(queue, orphan.Block.Header.Hash)
+		}
+		queue = queue[1:]
+	}
+}
+
+// FetchOrphanParents asks the peers for every block the orphan pool waits for. A fetched
+// block goes through ReceiveBlock, so it is inserted or waits for its own parent in turn.
+func FetchOrphanParents() {
+	ORPHANS.Expire()
+	for hash, height := range ORPHANS.Missing() {
+		if SBC.HasBlock(hash) {
+			// the parent arrived some other way
+			attachOrphans(hash)
+			continue
+		}
+		block := AskForBlock(height, hash)
+		if block == nil {
+			continue
+		}
+		if err := ReceiveBlock(data.Orphan{Block: *block}); err != nil {
+			fmt.Println("FORWARD/ ancestor block rejected: ", err)
+		}
+	}
+}
+
+// StartOrphanFetch runs FetchOrphanParents every ORPHAN_FETCH_INTERVAL
+func StartOrphanFetch() {
+	for ifStarted {
+		time.Sleep(ORPHAN_FETCH_INTERVAL)
+		if ORPHANS.Len() != 0 {
+			FetchOrphanParents()
+		}
+	}
+}
+
+// AskForBlock will be called in FetchOrphanParents,
 // in AskForBlock you will call http get to
 // /localhost:port/block/{height}/{hash} (UploadBlock) to get the Block
 // Loop through all peers in local PeerMap to download a block. As soon as one peer returns the block, stop the loop.
-
-// AskForBlock(): Update this function to recursively ask for all the missing predesessor blocks instead of only the parent block.
-func AskForBlock(height int32, hash string) string {
+// Returns nil if no peer has a block with that hash.
+func AskForBlock(height int32, hash string) *p2.Block {
 	peerMap := Peers.Copy()
 	for k := range peerMap {
-		body, code := AskForBlockHttpRequest(k, height, hash)
+		block, code := AskForBlockHttpRequest(k, height, hash)
 		if code == 200 {
-			parentBlock := p2.DecodeFromJson(body)
-			parentHash := parentBlock.Header.ParentHash
-			parentHeight := parentBlock.Header.Height
-			if parentBlock.Header.ParentHash == "genesis" {
-				SBC.Insert(*parentBlock)
-				return "success"
+			if block.Header.Hash != hash || block.Verify() != nil {
+				continue
 			}
-			block := SBC.GetParentBlock(*parentBlock)
-			if block.Header.Height > 1 {
-				result := AskForBlock(parentHeight-1, parentHash)
-				if result == "success" {
-					SBC.Insert(*parentBlock)
-				}
-				return result
-			} else {
-				return "success"
-			}
-
+			return block
 		}
 	}
-	return ""
+	return nil
 }
 
-func AskForBlockHttpRequest(addr string, height int32, hash string) (string, int) {
-	response, err := http.Get(addr + "/block/" + string(height) + "/" + hash)
+// AskForBlockHttpRequest asks for binary blocks and falls back to JSON for peers that
+// answer with it, the code is -1 if the block did not come or cannot be decoded
+func AskForBlockHttpRequest(addr string, height int32, hash string) (*p2.Block, int) {
+	req, err := http.NewRequest("GET", addr+"/block/"+strconv.Itoa(int(height))+"/"+hash, nil)
 	if err != nil {
 		fmt.Println(err)
+		return nil, -1
 	}
-	if response.StatusCode == 200 {
-		body, err := ioutil.ReadAll(response.Body)
+	req.Header.Set("Accept", p2.BINARY_CONTENT_TYPE+", "+p2.JSON_CONTENT_TYPE)
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return nil, -1
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, -1
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		fmt.Println(err)
+		return nil, -1
+	}
+	if isBinary(response.Header) {
+		block, err := p2.DecodeFromBinary(body)
 		if err != nil {
 			fmt.Println(err)
-			return string(body), -1
+			return nil, -1
 		}
-		return string(body), 200
+		return block, 200
+	}
+	block := p2.DecodeFromJson(string(body))
+	if block == nil {
+		return nil, -1
 	}
-	return "", -1
+	return block, 200
+}
+
+// AskForNode gets the encoding of an MPT node from the first peer that has it,
+// then from the download server. p2 checks the node against its hash.
+func AskForNode(hash string) ([]byte, error) {
+	addrs := []string{}
+	for addr := range Peers.Copy() {
+		addrs = append(addrs, addr)
+	}
+	addrs = append(addrs, TA_SERVER)
+	client := &http.Client{Timeout: NODE_FETCH_TIMEOUT}
+	for _, addr := range addrs {
+		response, err := client.Get(addr + "/node/" + hash)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err == nil && response.StatusCode == http.StatusOK {
+			return body, nil
+		}
+	}
+	return nil, errors.New("node " + hash + " not found at any peer")
 }
 
 // Send HeartBeat:
@@ -411,6 +684,12 @@ func StartHeartBeat() {
 		fmt.Println(SBC)
 		heartBeatData := data.PrepareHeartBeatData(&SBC, "", ID, peersJSON, SELF_ADDR)
 		ForwardHeartBeat(heartBeatData)
+		stats, err := SBC.PruneTries(ORPHANS.Roots()...)
+		if err != nil {
+			fmt.Println("START/ prune failed: ", err)
+		} else if stats.Removed > 0 {
+			fmt.Println("START/ pruned mpt nodes: ", stats.Removed, " of ", stats.Scanned)
+		}
 	}
 }
 
@@ -424,10 +703,16 @@ func Canonical(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res := ""
+	head, found := SBC.CanonicalHead()
+	if found {
+		res += "Canonical chain:\n" + GetChain(head) + "\n"
+	}
 	blocks := SBC.GetLatestBlocks()
 	fmt.Println("Canonical////////////////////////// ", len(blocks))
 	for _, v := range blocks {
-		res += GetChain(v) + "\n"
+		if !found || v.Header.Hash != head.Header.Hash {
+			res += "Fork:\n" + GetChain(v) + "\n"
+		}
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(res))
@@ -608,7 +893,11 @@ func Create(w http.ResponseWriter, r *http.Request) {
 	block, notEmpty := SBC.GetBlock(createinfo.ParentHeight, createinfo.ParentHash)
 	fmt.Println(block)
 	if notEmpty && block.VerifySecret(createinfo.Id, createinfo.Secret) {
-		CreateNewGameBlock(createinfo.ParentHash, createinfo.ParentHeight, createinfo.Id, createinfo.Content, createinfo.React, createinfo.Secret)
+		question := data.Question{Text: createinfo.Content, Answer: createinfo.React}
+		if createinfo.Question != nil {
+			question = *createinfo.Question
+		}
+		CreateNewGameBlock(createinfo.ParentHash, createinfo.ParentHeight, createinfo.Id, question, createinfo.Secret)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("create successfully"))
 		return
@@ -621,13 +910,16 @@ func GetChain(block p2.Block) string {
 	res := ""
 	for true {
 		blockJson := block.EncodeToJson()
+		res += fmt.Sprintf("height %d, created %s\n", block.Header.Height, block.CreatedAt().Format(time.RFC3339))
 		res += blockJson + "\n"
+		// the block only carries the root of its mpt, show the question itself too
+		res += "mpt: " + block.Value.GetJsonString() + "\n"
 		if block.Header.Height == 0 || block.Header.Height == 1 {
 			fmt.Println("empty")
 			break
 		}
 		block = SBC.GetParentBlock(block)
-		fmt.Println("parentBlock: ", block.Header.Height, "\n")
+		fmt.Println("parentBlock: ", block.Header.Height)
 	}
 	return res
 }
@@ -636,22 +928,26 @@ func GetChain(block p2.Block) string {
 // Nonce is a string of 16 hexes such as "1f7b169c846f218a".
 // Initialize the rand when you start a new node with something unique about each node,
 // such as the current time or the port number. Here's the workflow of generating blocks:
-func CreateNewGameBlock(parentHash string, parentHeight int32, creatorId string, content string, react string, secret string) {
+func CreateNewGameBlock(parentHash string, parentHeight int32, creatorId string, question data.Question, secret string) {
 	fmt.Println("CreatGame")
 	if ifStarted {
-		mpt := data.GenMPT(content, react)
+		mpt, err := data.GenQuestionMPT(question)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 		parentBlock, notEmpty := SBC.GetBlock(parentHeight, parentHash)
 		if !notEmpty {
 			return
 		}
 		var rank map[string]int32
-		err := json.Unmarshal([]byte(parentBlock.GetRankString()), &rank)
+		err = json.Unmarshal([]byte(parentBlock.GetRankString()), &rank)
 		if rank[creatorId] == 0 {
 			rank[creatorId] = 1
 		} else {
 			rank[creatorId] = rank[creatorId] + 1
 		}
-		block := SBC.GenBlock(mpt, rank, creatorId)
+		block := SBC.GenBlockOn(parentBlock, mpt, rank, creatorId)
 		peersJSON, err := Peers.PeerMapToJson()
 		if err != nil {
 			log.Panic(err)
@@ -0,0 +1,99 @@
+package p3
+
+import (
+	"strings"
+	"testing"
+
+	"../p2"
+	"./data"
+)
+
+func TestGetChainShowsContent(t *testing.T) {
+	test_node(t)
+	head, found := SBC.CanonicalHead()
+	if !found {
+		t.Fatal("no head")
+	}
+	chain := GetChain(head)
+	if strings.Count(chain, `mpt: {"content":"question","react":"answer"}`) != 2 {
+		t.Fatalf("content of the blocks missing from\n%s", chain)
+	}
+}
+
+// use_orphan_pool gives ReceiveBlock an empty orphan pool
+func use_orphan_pool(t *testing.T) {
+	ORPHANS = data.NewOrphanPool(ORPHAN_POOL_SIZE, ORPHAN_MAX_AGE)
+	t.Cleanup(func() { ORPHANS = data.NewOrphanPool(ORPHAN_POOL_SIZE, ORPHAN_MAX_AGE) })
+}
+
+// next_block is a valid child of parent made by creator "1"
+func next_block(t *testing.T, parent p2.Block) p2.Block {
+	mpt, err := data.GenMPT("question", "answer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rank := map[string]int32{"1": parent.Header.Height + 1}
+	return *p2.NewBlock(parent.Header.Height+1, p2.NextTimeStamp(parent), parent.Header.Hash, mpt, rank, "1", "", map[string]string{})
+}
+
+func TestReceiveBlockAttachesOrphan(t *testing.T) {
+	test_node(t)
+	use_orphan_pool(t)
+	head, _ := SBC.CanonicalHead()
+	parent := next_block(t, head)
+	child := next_block(t, parent)
+
+	if err := ReceiveBlock(data.Orphan{Block: child}); err != nil {
+		t.Fatal(err)
+	}
+	if SBC.HasBlock(child.Header.Hash) || ORPHANS.Len() != 1 {
+		t.Fatalf("a block without parent was not kept aside, %d orphans", ORPHANS.Len())
+	}
+	if err := ReceiveBlock(data.Orphan{Block: parent}); err != nil {
+		t.Fatal(err)
+	}
+	if !SBC.HasBlock(child.Header.Hash) || ORPHANS.Len() != 0 {
+		t.Fatalf("the orphan was not attached to its parent, %d orphans", ORPHANS.Len())
+	}
+	if head, _ := SBC.CanonicalHead(); head.Header.Hash != child.Header.Hash {
+		t.Fatalf("head %s, want %s", head.Header.Hash, child.Header.Hash)
+	}
+}
+
+func TestReceiveBlockAttachesChainedOrphans(t *testing.T) {
+	test_node(t)
+	use_orphan_pool(t)
+	head, _ := SBC.CanonicalHead()
+	blocks := []p2.Block{next_block(t, head)}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, next_block(t, blocks[len(blocks)-1]))
+	}
+	// a child with a wrong rank is dropped, and its own child with it
+	bad := *p2.NewBlock(blocks[1].Header.Height+1, p2.NextTimeStamp(blocks[1]), blocks[1].Header.Hash, blocks[1].Value,
+		map[string]int32{"1": 9}, "1", "", map[string]string{})
+	below_bad := next_block(t, bad)
+
+	// the newest first, every one of them waits for its parent
+	for i := len(blocks) - 1; i > 0; i-- {
+		ReceiveBlock(data.Orphan{Block: blocks[i]})
+	}
+	ReceiveBlock(data.Orphan{Block: bad})
+	ReceiveBlock(data.Orphan{Block: below_bad})
+	if ORPHANS.Len() != 5 {
+		t.Fatalf("%d orphans, want 5", ORPHANS.Len())
+	}
+	if err := ReceiveBlock(data.Orphan{Block: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if !SBC.HasBlock(block.Header.Hash) {
+			t.Fatalf("block at height %d was not attached", block.Header.Height)
+		}
+	}
+	if SBC.HasBlock(bad.Header.Hash) || SBC.HasBlock(below_bad.Header.Hash) || ORPHANS.Len() != 0 {
+		t.Fatalf("an invalid orphan was attached, %d orphans left", ORPHANS.Len())
+	}
+	if head, _ := SBC.CanonicalHead(); head.Header.Hash != blocks[3].Header.Hash {
+		t.Fatalf("head at height %d, want %d", head.Header.Height, blocks[3].Header.Height)
+	}
+}
@@ -30,6 +30,24 @@ var routes = Routes{
 		"/block/{height}/{hash}",
 		UploadBlock,
 	},
+	Route{
+		"UploadNode",
+		"GET",
+		"/node/{hash}",
+		UploadNode,
+	},
+	Route{
+		"Export",
+		"GET",
+		"/export",
+		Export,
+	},
+	Route{
+		"Import",
+		"POST",
+		"/import",
+		Import,
+	},
 	Route{
 		"HeartBeatReceive",
 		"POST",